@@ -0,0 +1,303 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// timestampFormat prefixes artifact directories; a random suffix keeps
+// directories of concurrent calls apart.
+const timestampFormat = "20060102-150405.000000"
+
+// pruneGrace protects fresh directories, which may still be written to,
+// from size-based pruning.
+const pruneGrace = time.Minute
+
+// legacyPattern matches the directories older versions created for each
+// call directly in the temp directory.
+var legacyPattern = regexp.MustCompile(`^modagent-\d{8}-\d{6}-\d{6}$`)
+
+// Artifact is the directory holding the saved output of one call.
+type Artifact struct {
+	Path    string    `json:"path"`
+	Scope   string    `json:"scope"`
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"`
+	// Legacy artifacts were left in the temp directory by older versions
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// Policy bounds how long artifacts are kept and how much space they take.
+type Policy struct {
+	// MaxAge of 0 keeps artifacts regardless of age.
+	MaxAge time.Duration
+	// MaxTotalSize of 0 doesn't limit the total size; otherwise the oldest
+	// artifacts are removed first.
+	MaxTotalSize int64
+	// CleanupInterval is how often the policy is applied in the background.
+	CleanupInterval time.Duration
+}
+
+// Store keeps artifact directories below a root, grouped by conversation
+// scope: <root>/<scope>/<timestamp>-<suffix>. The current user's
+// directories of older versions in the temp directory are listed and pruned
+// along with them.
+type Store struct {
+	root      string
+	legacyDir string
+	// Sanitize masks secrets in text served to clients.
+	Sanitize func(string) string
+	// mu serialises pruning and guards the published resources; creating
+	// directories needs no lock
+	mu        sync.Mutex
+	mcpServer *server.MCPServer
+	// owners maps URIs of announced files to the client session of the
+	// call that created them, "" without a session
+	owners map[string]string
+	// sessions maps URIs of resources published for a single client
+	// session to the session ID
+	sessions map[string]string
+}
+
+// DefaultRoot is below the user's cache directory rather than the shared
+// temp directory, where other users could create it first.
+func DefaultRoot() string {
+	return filepath.Join(xdg.CacheHome, "modagent", "artifacts")
+}
+
+func NewStore(root string) *Store {
+	return &Store{root: root, legacyDir: os.TempDir()}
+}
+
+func (s *Store) Root() string {
+	return s.root
+}
+
+// Create makes a new, unique directory for the artifacts of a call.
+func (s *Store) Create(scope string) (string, error) {
+	if err := s.checkRoot(); err != nil {
+		return "", err
+	}
+	parent := filepath.Join(s.root, scope)
+	var dir string
+	var err error
+	// Pruning removes empty scope directories, possibly right after
+	// MkdirAll; one retry is enough
+	for range 2 {
+		if err = os.MkdirAll(parent, 0o700); err != nil {
+			break
+		}
+		if dir, err = os.MkdirTemp(parent, time.Now().Format(timestampFormat)+"-*"); !os.IsNotExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifacts directory: %w", err)
+	}
+	// MkdirTemp creates private directories: command output may hold
+	// secrets
+	return dir, nil
+}
+
+// checkRoot creates the root and makes sure that only the current user can
+// change it: whoever owns it could swap scope directories for their own.
+func (s *Store) checkRoot() error {
+	if err := os.MkdirAll(s.root, 0o700); err != nil {
+		return fmt.Errorf("failed to create artifacts directory: %w", err)
+	}
+	info, err := os.Lstat(s.root)
+	if err != nil {
+		return fmt.Errorf("failed to check artifacts directory: %w", err)
+	}
+	if !info.IsDir() || !ownedByUser(info) {
+		return fmt.Errorf("artifacts directory %s is not a directory owned by the current user", s.root)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("artifacts directory %s is accessible to other users (mode %v), expected 0700", s.root, info.Mode().Perm())
+	}
+	return nil
+}
+
+func ownedByUser(info fs.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
+
+// List returns all artifacts, oldest first.
+func (s *Store) List() ([]Artifact, error) {
+	scopes, err := os.ReadDir(s.root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	var list []Artifact
+	for _, scope := range scopes {
+		if !scope.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.root, scope.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			a := Artifact{Path: filepath.Join(s.root, scope.Name(), entry.Name()), Scope: scope.Name()}
+			a.Created, a.Size = inspect(a.Path, entry)
+			list = append(list, a)
+		}
+	}
+	list = append(list, s.listLegacy()...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+func (s *Store) listLegacy() []Artifact {
+	if s.legacyDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(s.legacyDir)
+	if err != nil {
+		return nil
+	}
+	var list []Artifact
+	for _, entry := range entries {
+		if !entry.IsDir() || !legacyPattern.MatchString(entry.Name()) {
+			continue
+		}
+		// The temp directory is shared: leave other users' directories be
+		if info, err := entry.Info(); err != nil || !ownedByUser(info) {
+			continue
+		}
+		a := Artifact{Path: filepath.Join(s.legacyDir, entry.Name()), Legacy: true}
+		a.Created, a.Size = inspect(a.Path, entry)
+		list = append(list, a)
+	}
+	return list
+}
+
+// inspect returns the creation time of an artifact directory, taken from
+// its name where possible, and the size of its files.
+func inspect(path string, entry fs.DirEntry) (time.Time, int64) {
+	name := entry.Name()
+	created, err := time.ParseInLocation(timestampFormat, name[:min(len(name), len(timestampFormat))], time.Local)
+	if err != nil {
+		if info, err := entry.Info(); err == nil {
+			created = info.ModTime()
+		}
+	}
+
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return created, size
+}
+
+// Prune removes the artifacts that are older than the policy allows, then
+// the oldest ones until the rest fit the size limit, and returns what was
+// removed.
+func (s *Store) Prune(policy Policy, now time.Time) ([]Artifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, a := range list {
+		total += a.Size
+	}
+
+	var removed []Artifact
+	for _, a := range list {
+		expired := policy.MaxAge > 0 && now.Sub(a.Created) > policy.MaxAge
+		oversize := policy.MaxTotalSize > 0 && total > policy.MaxTotalSize && now.Sub(a.Created) > pruneGrace
+		if !expired && !oversize {
+			continue
+		}
+		if err := s.remove(a); err != nil {
+			return removed, err
+		}
+		total -= a.Size
+		removed = append(removed, a)
+	}
+	return removed, nil
+}
+
+// Clear removes all artifacts.
+func (s *Store) Clear() ([]Artifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []Artifact
+	for _, a := range list {
+		if err := s.remove(a); err != nil {
+			return removed, err
+		}
+		removed = append(removed, a)
+	}
+	return removed, nil
+}
+
+// remove deletes an artifact, and its scope directory once it's empty.
+func (s *Store) remove(a Artifact) error {
+	s.unpublish(a.Path)
+	if err := os.RemoveAll(a.Path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", a.Path, err)
+	}
+	if !a.Legacy {
+		// Fails while other artifacts of the scope remain
+		_ = os.Remove(filepath.Dir(a.Path))
+	}
+	return nil
+}
+
+// RunCleanup applies the policy now and then every cleanup interval until
+// ctx is done.
+func (s *Store) RunCleanup(ctx context.Context, policy Policy) {
+	prune := func() {
+		if _, err := s.Prune(policy, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to prune artifacts: %v\n", err)
+		}
+	}
+	prune()
+	if policy.CleanupInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(policy.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			prune()
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package artifacts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+func newTestStore(t *testing.T) *Store {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-artifacts-*")
+	testutils.AssertNoError(t, err)
+	t.Cleanup(cleanup)
+	s := NewStore(dir)
+	s.legacyDir = t.TempDir()
+	return s
+}
+
+// addArtifact creates an artifact as if it had been created at the given
+// time, with size bytes of output.
+func addArtifact(t *testing.T, s *Store, scope string, created time.Time, size int) string {
+	path := filepath.Join(s.Root(), scope, created.Format(timestampFormat)+"-1")
+	testutils.AssertNoError(t, os.MkdirAll(path, 0o755))
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(path, "stdout"), []byte(strings.Repeat("x", size)), 0o644))
+	return path
+}
+
+func TestCreateUnique(t *testing.T) {
+	s := newTestStore(t)
+	const n = 50
+	dirs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dir, err := s.Create("scope")
+			testutils.AssertNoError(t, err)
+			dirs[i] = dir
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if seen[dir] {
+			t.Fatalf("Directory %s created twice", dir)
+		}
+		seen[dir] = true
+	}
+	list, err := s.List()
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, n, len(list))
+	if time.Since(list[0].Created) > time.Minute {
+		t.Fatalf("Creation time not parsed from the name: %v", list[0].Created)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []testutils.TableTest{
+		{Name: "max age", Input: Policy{MaxAge: 24 * time.Hour}, Expected: "old"},
+		{Name: "max total size removes the oldest first", Input: Policy{MaxTotalSize: 250}, Expected: "old"},
+		{Name: "max total size removes as many as needed", Input: Policy{MaxTotalSize: 150}, Expected: "old,middle"},
+		{Name: "fresh artifacts are kept", Input: Policy{MaxTotalSize: 1}, Expected: "old,middle"},
+		{Name: "no limits", Input: Policy{}, Expected: ""},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		s := newTestStore(t)
+		names := map[string]string{
+			addArtifact(t, s, "a", now.Add(-48*time.Hour), 100): "old",
+			addArtifact(t, s, "b", now.Add(-time.Hour), 100):    "middle",
+			addArtifact(t, s, "a", now, 100):                    "new",
+		}
+		removed, err := s.Prune(tt.Input.(Policy), now)
+		testutils.AssertNoError(t, err)
+		var got []string
+		for _, a := range removed {
+			got = append(got, names[a.Path])
+			if _, err := os.Stat(a.Path); !os.IsNotExist(err) {
+				t.Fatalf("Artifact %s not removed", a.Path)
+			}
+		}
+		testutils.AssertEqual(t, tt.Expected, strings.Join(got, ","))
+	})
+}
+
+func TestClear(t *testing.T) {
+	s := newTestStore(t)
+	addArtifact(t, s, "a", time.Now(), 10)
+	addArtifact(t, s, "b", time.Now(), 10)
+	removed, err := s.Clear()
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 2, len(removed))
+
+	// Empty scope directories go too
+	entries, err := os.ReadDir(s.Root())
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 0, len(entries))
+}
+
+func TestListLegacyNames(t *testing.T) {
+	s := newTestStore(t)
+	path := filepath.Join(s.Root(), "scope", "20240102-150405-000000")
+	testutils.AssertNoError(t, os.MkdirAll(path, 0o755))
+	list, err := s.List()
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 1, len(list))
+	if time.Since(list[0].Created) > time.Minute {
+		t.Fatalf("Expected the modification time, got %v", list[0].Created)
+	}
+}
+
+func TestCreatePrivate(t *testing.T) {
+	s := newTestStore(t)
+	dir, err := s.Create("scope")
+	testutils.AssertNoError(t, err)
+	info, err := os.Stat(dir)
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, os.FileMode(0o700), info.Mode().Perm())
+}
+
+func TestPruneLegacy(t *testing.T) {
+	s := newTestStore(t)
+	legacy := filepath.Join(s.legacyDir, "modagent-20240102-150405-000000")
+	other := filepath.Join(s.legacyDir, "modagent-test-config-1")
+	for _, dir := range []string{legacy, other} {
+		testutils.AssertNoError(t, os.MkdirAll(dir, 0o700))
+		old := time.Now().Add(-48 * time.Hour)
+		testutils.AssertNoError(t, os.Chtimes(dir, old, old))
+	}
+
+	removed, err := s.Prune(Policy{MaxAge: 24 * time.Hour}, time.Now())
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 1, len(removed))
+	testutils.AssertEqual(t, legacy, removed[0].Path)
+	testutils.AssertEqual(t, true, removed[0].Legacy)
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("Expected unrelated directory to be kept: %v", err)
+	}
+}
+
+func TestCreateRejectsSharedRoot(t *testing.T) {
+	s := newTestStore(t)
+	testutils.AssertNoError(t, os.Chmod(s.Root(), 0o755))
+	_, err := s.Create("scope")
+	testutils.AssertError(t, err)
+
+	if os.Getuid() != 0 {
+		t.Skip("changing owners needs root")
+	}
+	testutils.AssertNoError(t, os.Chmod(s.Root(), 0o700))
+	testutils.AssertNoError(t, os.Chown(s.Root(), 65534, 65534))
+	_, err = s.Create("scope")
+	testutils.AssertError(t, err)
+}
+
+func TestPruneLegacySkipsOtherUsers(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing owners needs root")
+	}
+	s := newTestStore(t)
+	foreign := filepath.Join(s.legacyDir, "modagent-20240102-150405-000000")
+	testutils.AssertNoError(t, os.MkdirAll(foreign, 0o700))
+	testutils.AssertNoError(t, os.Chown(foreign, 65534, 65534))
+
+	list, err := s.List()
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 0, len(list))
+	removed, err := s.Clear()
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 0, len(removed))
+	if _, err := os.Stat(foreign); err != nil {
+		t.Fatalf("Expected another user's directory to be kept: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	ResourceURIPrefix   = "modagent://artifact/"
+	ResourceURITemplate = ResourceURIPrefix + "{+path}"
+	textMIMEType        = "text/plain"
+	binaryMIMEType      = "application/octet-stream"
+)
+
+// File is a file of an artifact, as published to MCP clients.
+type File struct {
+	URI string `json:"uri"`
+	// Name is the path within the artifact, e.g. "stdout" or "2/stderr".
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// Publish exposes artifacts as MCP resources: listed resources for the
+// files announced by Announce until they are removed, and a template for
+// direct reads. Either way only announced files are served, and only to the
+// client session they were announced for.
+func (s *Store) Publish(mcpServer *server.MCPServer) {
+	template := mcp.NewResourceTemplate(ResourceURITemplate, "artifact",
+		mcp.WithTemplateDescription("Saved output of a bash command, such as stdout or stderr"),
+	)
+	mcpServer.AddResourceTemplate(template, s.HandleRead)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mcpServer = mcpServer
+	s.owners = make(map[string]string)
+	s.sessions = make(map[string]string)
+}
+
+// Announce lists the files of an artifact directory and, once published,
+// adds them as resources, only for the client session of ctx where the
+// transport supports it.
+func (s *Store) Announce(ctx context.Context, dir string) ([]File, error) {
+	files, err := s.files(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mcpServer == nil {
+		return files, nil
+	}
+	var sessionID string
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		sessionID = session.SessionID()
+	}
+	for _, file := range files {
+		s.owners[file.URI] = sessionID
+		resource := mcp.NewResource(file.URI, filepath.Base(dir)+"/"+file.Name,
+			mcp.WithResourceDescription(fmt.Sprintf("Bash command output, %d bytes", file.Size)),
+			mcp.WithMIMEType(file.MIMEType),
+		)
+		if sessionID != "" {
+			err := s.mcpServer.AddSessionResource(sessionID, resource, s.HandleRead)
+			if err == nil {
+				s.sessions[file.URI] = sessionID
+				continue
+			}
+			// Transports like stdio serve a single client, so global is fine
+		}
+		s.mcpServer.AddResource(resource, s.HandleRead)
+	}
+	return files, nil
+}
+
+// unpublish removes the resources of an artifact that is about to be
+// deleted.
+func (s *Store) unpublish(dir string) {
+	if s.mcpServer == nil {
+		return
+	}
+	files, err := s.files(dir)
+	if err != nil {
+		return
+	}
+	var uris []string
+	for _, file := range files {
+		delete(s.owners, file.URI)
+		if sessionID, ok := s.sessions[file.URI]; ok {
+			_ = s.mcpServer.DeleteSessionResources(sessionID, file.URI)
+			delete(s.sessions, file.URI)
+			continue
+		}
+		uris = append(uris, file.URI)
+	}
+	s.mcpServer.DeleteResources(uris...)
+}
+
+func (s *Store) files(dir string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(dir, path)
+		uri, err := s.ResourceURI(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{URI: uri, Name: filepath.ToSlash(name), MIMEType: mimeType(path), Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifact %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// ResourceURI returns the URI of a file in the store.
+func (s *Store) ResourceURI(path string) (string, error) {
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not an artifact", path)
+	}
+	return ResourceURIPrefix + filepath.ToSlash(rel), nil
+}
+
+// path resolves a resource URI to a file in the store.
+func (s *Store) path(uri string) (string, error) {
+	rel, ok := strings.CutPrefix(uri, ResourceURIPrefix)
+	if !ok || rel == "" {
+		return "", fmt.Errorf("invalid artifact URI: %s", uri)
+	}
+	rel = filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid artifact URI: %s", uri)
+	}
+	return filepath.Join(s.root, rel), nil
+}
+
+// announced reports whether the file was announced for the client session
+// of ctx.
+func (s *Store) announced(ctx context.Context, uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner, ok := s.owners[uri]
+	if !ok {
+		return false
+	}
+	if session := server.ClientSessionFromContext(ctx); session != nil && owner != "" {
+		return owner == session.SessionID()
+	}
+	return true
+}
+
+func (s *Store) HandleRead(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	path, err := s.path(request.Params.URI)
+	if err != nil {
+		return nil, err
+	}
+	if !s.announced(ctx, request.Params.URI) {
+		return nil, fmt.Errorf("artifact not found: %s", request.Params.URI)
+	}
+	content, err := readRegular(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+
+	mimeType := mimeType(path)
+	if utf8.Valid(content) {
+		text := string(content)
+		if s.Sanitize != nil {
+			text = s.Sanitize(text)
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{URI: request.Params.URI, MIMEType: mimeType, Text: text},
+		}, nil
+	}
+	if mimeType == textMIMEType {
+		mimeType = binaryMIMEType
+	}
+	return []mcp.ResourceContents{
+		mcp.BlobResourceContents{URI: request.Params.URI, MIMEType: mimeType, Blob: base64.StdEncoding.EncodeToString(content)},
+	}, nil
+}
+
+// readRegular reads a file, refusing symlinks and anything else that isn't a
+// regular file, including a file swapped in between the checks.
+func readRegular(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	opened, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !os.SameFile(info, opened) {
+		return nil, fmt.Errorf("%s changed while reading", path)
+	}
+	return io.ReadAll(f)
+}
+
+// mimeType guesses from the extension; the output files modagent writes
+// have none and are text.
+func mimeType(path string) string {
+	if ext := filepath.Ext(path); ext != "" {
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+		return binaryMIMEType
+	}
+	return textMIMEType
+}
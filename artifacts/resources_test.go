@@ -0,0 +1,141 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func request(t *testing.T, mcpServer *server.MCPServer, method string, params any, result any) {
+	message, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	testutils.AssertNoError(t, err)
+	response := mcpServer.HandleMessage(context.Background(), message)
+	data, err := json.Marshal(response)
+	testutils.AssertNoError(t, err)
+	var parsed struct {
+		Result json.RawMessage `json:"result"`
+		Error  any             `json:"error"`
+	}
+	testutils.AssertNoError(t, json.Unmarshal(data, &parsed))
+	if parsed.Error != nil {
+		t.Fatalf("%s failed: %v", method, parsed.Error)
+	}
+	testutils.AssertNoError(t, json.Unmarshal(parsed.Result, result))
+}
+
+func TestPublishAndRead(t *testing.T) {
+	s := newTestStore(t)
+	mcpServer := server.NewMCPServer("test", "0", server.WithResourceCapabilities(false, true))
+	s.Publish(mcpServer)
+
+	dir, err := s.Create("scope")
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, os.MkdirAll(filepath.Join(dir, "2"), 0o755))
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(dir, "2", "stdout"), []byte("full output\n"), 0o644))
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(dir, "stdin"), []byte{0xff, 0x00}, 0o644))
+
+	files, err := s.Announce(context.Background(), dir)
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 2, len(files))
+	testutils.AssertEqual(t, "2/stdout", files[0].Name)
+	testutils.AssertEqual(t, "text/plain", files[0].MIMEType)
+	testutils.AssertEqual(t, int64(12), files[0].Size)
+
+	var list mcp.ListResourcesResult
+	request(t, mcpServer, "resources/list", map[string]any{}, &list)
+	testutils.AssertEqual(t, 2, len(list.Resources))
+
+	var read struct {
+		Contents []map[string]any `json:"contents"`
+	}
+	request(t, mcpServer, "resources/read", map[string]any{"uri": files[0].URI}, &read)
+	testutils.AssertEqual(t, "full output\n", read.Contents[0]["text"])
+	request(t, mcpServer, "resources/read", map[string]any{"uri": files[1].URI}, &read)
+	testutils.AssertEqual(t, "/wA=", read.Contents[0]["blob"])
+	testutils.AssertEqual(t, "application/octet-stream", read.Contents[0]["mimeType"])
+
+	// Pruned artifacts disappear from the list
+	_, err = s.Prune(Policy{MaxAge: time.Nanosecond}, time.Now().Add(time.Second))
+	testutils.AssertNoError(t, err)
+	request(t, mcpServer, "resources/list", map[string]any{}, &list)
+	testutils.AssertEqual(t, 0, len(list.Resources))
+}
+
+func TestHandleReadRejectsEscapes(t *testing.T) {
+	s := newTestStore(t)
+	for _, uri := range []string{
+		ResourceURIPrefix + "../secret",
+		ResourceURIPrefix + "scope/../../secret",
+		ResourceURIPrefix,
+		"modagent://conversation/x",
+	} {
+		req := mcp.ReadResourceRequest{}
+		req.Params.URI = uri
+		_, err := s.HandleRead(context.Background(), req)
+		testutils.AssertError(t, err)
+	}
+}
+
+type testSession struct{ id string }
+
+func (s testSession) Initialize()       {}
+func (s testSession) Initialized() bool { return true }
+func (s testSession) SessionID() string { return s.id }
+func (s testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return make(chan mcp.JSONRPCNotification, 1)
+}
+
+func TestHandleReadServesAnnouncedFiles(t *testing.T) {
+	s := newTestStore(t)
+	s.Sanitize = func(text string) string { return strings.ReplaceAll(text, "hunter2", "[REDACTED]") }
+	mcpServer := server.NewMCPServer("test", "0", server.WithResourceCapabilities(false, true))
+	s.Publish(mcpServer)
+	owner := mcpServer.WithContext(context.Background(), testSession{id: "s1"})
+	other := mcpServer.WithContext(context.Background(), testSession{id: "s2"})
+
+	dir, err := s.Create("scope")
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(dir, "stdout"), []byte("password hunter2\n"), 0o600))
+	files, err := s.Announce(owner, dir)
+	testutils.AssertNoError(t, err)
+	// Written after the announcement, so never published
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(dir, "stderr"), []byte("late\n"), 0o600))
+	secret := filepath.Join(t.TempDir(), "secret")
+	testutils.AssertNoError(t, os.WriteFile(secret, []byte("secret\n"), 0o600))
+
+	read := func(ctx context.Context, uri string) (string, error) {
+		req := mcp.ReadResourceRequest{}
+		req.Params.URI = uri
+		contents, err := s.HandleRead(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		return contents[0].(mcp.TextResourceContents).Text, nil
+	}
+
+	text, err := read(owner, files[0].URI)
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "password [REDACTED]\n", text)
+
+	_, err = read(other, files[0].URI)
+	testutils.AssertError(t, err)
+	stderrURI, err := s.ResourceURI(filepath.Join(dir, "stderr"))
+	testutils.AssertNoError(t, err)
+	_, err = read(owner, stderrURI)
+	testutils.AssertError(t, err)
+
+	// A file swapped for a symlink after the announcement isn't followed
+	stdout := filepath.Join(dir, "stdout")
+	testutils.AssertNoError(t, os.Remove(stdout))
+	testutils.AssertNoError(t, os.Symlink(secret, stdout))
+	_, err = read(owner, files[0].URI)
+	testutils.AssertError(t, err)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/config"
+)
+
+// runArtifacts implements the "modagent artifacts" subcommand.
+func runArtifacts(cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: modagent artifacts list|prune ...")
+	}
+	store := artifacts.NewStore(cfg.GetArtifactsDir())
+
+	switch args[0] {
+	case "list":
+		return listArtifacts(store, args[1:], out)
+	case "prune":
+		policy, _ := cfg.GetArtifactsPolicy()
+		return pruneArtifacts(store, policy, args[1:], out)
+	default:
+		return fmt.Errorf("unknown command %q (valid: list, prune)", args[0])
+	}
+}
+
+func listArtifacts(store *artifacts.Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("artifacts list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print one JSON object per artifact")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	list, err := store.List()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, a := range list {
+		total += a.Size
+		if *asJSON {
+			line, _ := json.Marshal(a)
+			fmt.Fprintln(out, string(line))
+			continue
+		}
+		fmt.Fprintln(out, formatArtifact(a))
+	}
+	if !*asJSON {
+		fmt.Fprintf(out, "%d artifacts, %s in %s\n", len(list), formatSize(total), store.Root())
+	}
+	return nil
+}
+
+func pruneArtifacts(store *artifacts.Store, policy artifacts.Policy, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("artifacts prune", flag.ContinueOnError)
+	maxAge := fs.Duration("max-age", policy.MaxAge, "Remove artifacts older than this")
+	maxTotalSizeMB := fs.Int64("max-total-size-mb", policy.MaxTotalSize>>20, "Remove the oldest artifacts until the rest fit in this many MB")
+	all := fs.Bool("all", false, "Remove all artifacts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var removed []artifacts.Artifact
+	var err error
+	if *all {
+		removed, err = store.Clear()
+	} else {
+		policy = artifacts.Policy{MaxAge: *maxAge, MaxTotalSize: *maxTotalSizeMB << 20}
+		removed, err = store.Prune(policy, time.Now())
+	}
+	var freed int64
+	for _, a := range removed {
+		freed += a.Size
+	}
+	fmt.Fprintf(out, "removed %d artifacts, freed %s\n", len(removed), formatSize(freed))
+	return err
+}
+
+func formatArtifact(a artifacts.Artifact) string {
+	return strings.Join([]string{
+		a.Created.Local().Format(time.DateTime),
+		formatSize(a.Size),
+		a.Path,
+	}, "\t")
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,265 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Entry is a single audit record, serialized as one JSONL line.
+type Entry struct {
+	Time         time.Time      `json:"time"`
+	Session      string         `json:"session,omitempty"`
+	Client       string         `json:"client,omitempty"`
+	Tool         string         `json:"tool"`
+	Arguments    map[string]any `json:"arguments,omitempty"`
+	BashCmd      string         `json:"bash_cmd,omitempty"`
+	ExitStatus   *int           `json:"exit_status,omitempty"`
+	Backend      string         `json:"backend,omitempty"`
+	Role         string         `json:"role,omitempty"`
+	DurationMs   int64          `json:"duration_ms"`
+	Conversation string         `json:"conversation,omitempty"`
+	Job          string         `json:"job,omitempty"`
+	ResultSize   int            `json:"result_size"`
+	Status       string         `json:"status"`
+	Error        string         `json:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+// SetExec records the executed bash command and its exit status.
+func (e *Entry) SetExec(bashCmd string, exitStatus int) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.BashCmd = bashCmd
+	e.ExitStatus = &exitStatus
+}
+
+// SetModel records the backend and role the call was routed to.
+func (e *Entry) SetModel(backend, role string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Backend = backend
+	e.Role = role
+}
+
+// SetConversation records the conversation the call belongs to.
+func (e *Entry) SetConversation(id string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Conversation = id
+}
+
+// SetJob records the background job the call started or ran as.
+func (e *Entry) SetJob(id string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Job = id
+}
+
+type entryKey struct{}
+
+// FromContext returns the entry of the current call, or nil if not audited.
+func FromContext(ctx context.Context) *Entry {
+	entry, _ := ctx.Value(entryKey{}).(*Entry)
+	return entry
+}
+
+// Settings configures the audit log.
+type Settings struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+}
+
+// Logger appends entries to a JSONL file, rotating it when it grows past
+// MaxSize.
+type Logger struct {
+	settings Settings
+	// Sanitize masks secrets in recorded strings.
+	Sanitize func(string) string
+	mu       sync.Mutex
+}
+
+func NewLogger(settings Settings) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(settings.Path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	return &Logger{settings: settings}, nil
+}
+
+// Middleware records every tool invocation that passes through it.
+func (l *Logger) Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		entry := &Entry{
+			Time:      time.Now().UTC(),
+			Tool:      request.Params.Name,
+			Arguments: l.sanitizeArgs(request.GetArguments()),
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			entry.Session = session.SessionID()
+			if info, ok := session.(server.SessionWithClientInfo); ok {
+				entry.Client = info.GetClientInfo().Name
+			}
+		}
+
+		result, err := next(context.WithValue(ctx, entryKey{}, entry), request)
+
+		entry.mu.Lock()
+		entry.DurationMs = time.Since(entry.Time).Milliseconds()
+		entry.BashCmd = l.sanitize(entry.BashCmd)
+		entry.Status = StatusOK
+		switch {
+		case err != nil:
+			entry.Status = StatusError
+			entry.Error = err.Error()
+		case result != nil && result.IsError:
+			entry.Status = StatusError
+		}
+		if result != nil {
+			for _, content := range result.Content {
+				if text, ok := content.(mcp.TextContent); ok {
+					entry.ResultSize += len(text.Text)
+					if result.IsError && entry.Error == "" {
+						entry.Error = l.sanitize(text.Text)
+					}
+				}
+			}
+		}
+		entry.mu.Unlock()
+
+		if werr := l.Write(entry); werr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", werr)
+		}
+		return result, err
+	}
+}
+
+// Write appends an entry to the log.
+func (l *Logger) Write(entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.rotateIfNeeded(int64(len(line))); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.settings.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line)
+	return err
+}
+
+func (l *Logger) rotateIfNeeded(incoming int64) error {
+	if l.settings.MaxSize <= 0 {
+		return nil
+	}
+	info, err := os.Stat(l.settings.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size()+incoming <= l.settings.MaxSize {
+		return nil
+	}
+
+	if l.settings.MaxBackups <= 0 {
+		return os.Remove(l.settings.Path)
+	}
+	os.Remove(backupPath(l.settings.Path, l.settings.MaxBackups))
+	for i := l.settings.MaxBackups - 1; i >= 1; i-- {
+		if _, err := os.Stat(backupPath(l.settings.Path, i)); err == nil {
+			if err := os.Rename(backupPath(l.settings.Path, i), backupPath(l.settings.Path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(l.settings.Path, backupPath(l.settings.Path, 1))
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func (l *Logger) sanitize(s string) string {
+	if l.Sanitize == nil {
+		return s
+	}
+	return l.Sanitize(s)
+}
+
+func (l *Logger) sanitizeArgs(args map[string]any) map[string]any {
+	sanitized := make(map[string]any, len(args))
+	for key, val := range args {
+		switch key {
+		case "env":
+			// Values of explicitly passed variables are never recorded
+			if vars, ok := val.(map[string]any); ok {
+				masked := make(map[string]any, len(vars))
+				for name := range vars {
+					masked[name] = "[REDACTED]"
+				}
+				sanitized[key] = masked
+				continue
+			}
+		}
+		sanitized[key] = l.sanitizeValue(val)
+	}
+	return sanitized
+}
+
+// sanitizeValue sanitizes the strings of arbitrarily nested arguments, such
+// as bash_cmds or json_schema.
+func (l *Logger) sanitizeValue(val any) any {
+	switch val := val.(type) {
+	case string:
+		return l.sanitize(val)
+	case []any:
+		sanitized := make([]any, len(val))
+		for i, item := range val {
+			sanitized[i] = l.sanitizeValue(item)
+		}
+		return sanitized
+	case map[string]any:
+		sanitized := make(map[string]any, len(val))
+		for key, item := range val {
+			sanitized[key] = l.sanitizeValue(item)
+		}
+		return sanitized
+	}
+	return val
+}
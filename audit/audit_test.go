@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func newTestLogger(t *testing.T, maxSize int64, maxBackups int) (*Logger, Settings) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-audit-*")
+	testutils.AssertNoError(t, err)
+	t.Cleanup(cleanup)
+
+	settings := Settings{
+		Path:       filepath.Join(dir, "audit.jsonl"),
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}
+	logger, err := NewLogger(settings)
+	testutils.AssertNoError(t, err)
+	return logger, settings
+}
+
+func TestMiddleware(t *testing.T) {
+	logger, settings := newTestLogger(t, 0, 0)
+	logger.Sanitize = func(s string) string {
+		return strings.ReplaceAll(s, "hunter2", "[REDACTED]")
+	}
+
+	handler := logger.Middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		entry := FromContext(ctx)
+		entry.SetExec("echo hunter2", 3)
+		entry.SetModel("mods", "junior-r")
+		entry.SetConversation("abc123")
+		return mcp.NewToolResultText("result"), nil
+	})
+
+	request := testutils.CreateMCPRequest("junior-r", map[string]any{
+		"prompt":      "password is hunter2",
+		"env":         map[string]any{"TOKEN": "hunter2"},
+		"bash_cmds":   []any{"true", "login --password hunter2"},
+		"json_schema": map[string]any{"properties": map[string]any{"password": map[string]any{"const": "hunter2"}}},
+	})
+	_, err := handler(context.Background(), request)
+	testutils.AssertNoError(t, err)
+
+	data, err := os.ReadFile(settings.Path)
+	testutils.AssertNoError(t, err)
+	if strings.Contains(string(data), "hunter2") {
+		t.Fatalf("Expected secrets to be sanitized, got %s", data)
+	}
+
+	entries, err := Query(settings, Filter{})
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 1, len(entries))
+	entry := entries[0]
+	testutils.AssertEqual(t, "junior-r", entry.Tool)
+	testutils.AssertEqual(t, StatusOK, entry.Status)
+	testutils.AssertEqual(t, 3, *entry.ExitStatus)
+	testutils.AssertEqual(t, "junior-r", entry.Role)
+	testutils.AssertEqual(t, "abc123", entry.Conversation)
+	testutils.AssertEqual(t, len("result"), entry.ResultSize)
+}
+
+func TestMiddlewareRecordsErrors(t *testing.T) {
+	logger, settings := newTestLogger(t, 0, 0)
+	handler := logger.Middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultError("boom"), nil
+	})
+	_, err := handler(context.Background(), testutils.CreateMCPRequest("logworm", nil))
+	testutils.AssertNoError(t, err)
+
+	entries, err := Query(settings, Filter{Status: StatusError})
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 1, len(entries))
+	testutils.AssertEqual(t, "boom", entries[0].Error)
+}
+
+func TestRotation(t *testing.T) {
+	logger, settings := newTestLogger(t, 200, 2)
+	for i := 0; i < 10; i++ {
+		testutils.AssertNoError(t, logger.Write(&Entry{Time: time.Now(), Tool: "junior-r", Status: StatusOK}))
+	}
+
+	for _, path := range []string{settings.Path, settings.Path + ".1", settings.Path + ".2"} {
+		info, err := os.Stat(path)
+		testutils.AssertNoError(t, err)
+		if info.Size() > settings.MaxSize {
+			t.Fatalf("Expected %s to be at most %d bytes, got %d", path, settings.MaxSize, info.Size())
+		}
+	}
+	if _, err := os.Stat(settings.Path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected at most 2 backups")
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	logger, settings := newTestLogger(t, 0, 0)
+	now := time.Now().UTC()
+	entries := []*Entry{
+		{Time: now.Add(-48 * time.Hour), Tool: "junior-r", Status: StatusOK},
+		{Time: now.Add(-time.Hour), Tool: "junior-rwx", Status: StatusError},
+		{Time: now, Tool: "logworm", Status: StatusOK},
+	}
+	for _, entry := range entries {
+		testutils.AssertNoError(t, logger.Write(entry))
+	}
+
+	tests := []testutils.TableTest{
+		{Name: "all", Input: Filter{}, Expected: 3},
+		{Name: "since", Input: Filter{Since: now.Add(-24 * time.Hour)}, Expected: 2},
+		{Name: "until", Input: Filter{Until: now.Add(-24 * time.Hour)}, Expected: 1},
+		{Name: "tool", Input: Filter{Tool: "logworm"}, Expected: 1},
+		{Name: "status", Input: Filter{Status: StatusError}, Expected: 1},
+	}
+
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		result, err := Query(settings, tt.Input.(Filter))
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, tt.Expected, len(result))
+	})
+}
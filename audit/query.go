@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Filter selects audit entries; zero fields match everything.
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Tool   string
+	Status string
+}
+
+func (f Filter) matches(e *Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.Tool != "" && e.Tool != f.Tool {
+		return false
+	}
+	if f.Status != "" && e.Status != f.Status {
+		return false
+	}
+	return true
+}
+
+// Query reads the log and its rotated backups, oldest first, and returns
+// matching entries.
+func Query(settings Settings, filter Filter) ([]*Entry, error) {
+	var paths []string
+	for i := settings.MaxBackups; i >= 1; i-- {
+		paths = append(paths, backupPath(settings.Path, i))
+	}
+	paths = append(paths, settings.Path)
+
+	var entries []*Entry
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry Entry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				// Skip torn lines instead of failing the whole query
+				continue
+			}
+			if filter.matches(&entry) {
+				entries = append(entries, &entry)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/anuramat/modagent/audit"
+	"github.com/anuramat/modagent/config"
+)
+
+// runAudit implements the "modagent audit" subcommand.
+func runAudit(cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	since := fs.String("since", "", "Show entries after this time (RFC3339) or within this duration (e.g. 24h)")
+	until := fs.String("until", "", "Show entries before this time (RFC3339) or older than this duration")
+	tool := fs.String("tool", "", "Show only entries for this tool")
+	status := fs.String("status", "", "Show only entries with this status (ok or error)")
+	asJSON := fs.Bool("json", false, "Print raw JSONL entries")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var filter audit.Filter
+	var err error
+	if filter.Since, err = parseTimeArg(*since); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseTimeArg(*until); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+	if *status != "" && *status != audit.StatusOK && *status != audit.StatusError {
+		return fmt.Errorf("invalid --status: %s (valid: %s, %s)", *status, audit.StatusOK, audit.StatusError)
+	}
+	filter.Tool = *tool
+	filter.Status = *status
+
+	settings, _ := cfg.GetAuditSettings()
+	entries, err := audit.Query(settings, filter)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	for _, entry := range entries {
+		if *asJSON {
+			line, _ := json.Marshal(entry)
+			fmt.Fprintln(out, string(line))
+			continue
+		}
+		fmt.Fprintln(out, formatAuditEntry(entry))
+	}
+	return nil
+}
+
+func formatAuditEntry(e *audit.Entry) string {
+	parts := []string{
+		e.Time.Local().Format(time.DateTime),
+		e.Tool,
+		e.Status,
+		fmt.Sprintf("%dms", e.DurationMs),
+	}
+	if e.Role != "" {
+		parts = append(parts, "role="+e.Role)
+	}
+	if e.ExitStatus != nil {
+		parts = append(parts, fmt.Sprintf("exit=%d", *e.ExitStatus))
+	}
+	if e.Conversation != "" {
+		parts = append(parts, "conversation="+e.Conversation)
+	}
+	if e.BashCmd != "" {
+		parts = append(parts, fmt.Sprintf("bash_cmd=%q", e.BashCmd))
+	}
+	return strings.Join(parts, "\t")
+}
+
+// parseTimeArg accepts either an RFC3339 timestamp or a duration relative to
+// now.
+func parseTimeArg(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
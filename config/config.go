@@ -4,20 +4,124 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/audit"
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/core"
+	"github.com/anuramat/modagent/jobs"
 	"github.com/anuramat/modagent/junior"
+	"github.com/anuramat/modagent/limits"
 	"github.com/anuramat/modagent/logworm"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	Tools map[string]ToolConfig `yaml:"tools"`
+	Exec  *ExecConfig           `yaml:"exec,omitempty"`
+	Roots *RootsConfig          `yaml:"roots,omitempty"`
+	// Redaction is enabled unless explicitly disabled
+	Redaction *RedactionConfig `yaml:"redaction,omitempty"`
+	// Audit logging is enabled unless explicitly disabled
+	Audit  *AuditConfig  `yaml:"audit,omitempty"`
+	Limits *LimitsConfig `yaml:"limits,omitempty"`
+	// Sessions isolate conversations per MCP client unless disabled
+	Sessions *SessionsConfig `yaml:"sessions,omitempty"`
+	// Compaction of long conversations is enabled unless explicitly disabled
+	Compaction *CompactionConfig `yaml:"compaction,omitempty"`
+	Files      *FilesConfig      `yaml:"files,omitempty"`
+	// Attachments describe what the model backend accepts besides text
+	Attachments *AttachmentsConfig `yaml:"attachments,omitempty"`
+	// Artifacts of bash commands are cleaned up unless explicitly disabled
+	Artifacts *ArtifactsConfig `yaml:"artifacts,omitempty"`
+}
+
+type ArtifactsConfig struct {
+	Dir             string        `yaml:"dir,omitempty"`
+	Cleanup         *bool         `yaml:"cleanup,omitempty"`
+	MaxAge          time.Duration `yaml:"max_age,omitempty"`
+	MaxTotalSizeMB  int           `yaml:"max_total_size_mb,omitempty"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval,omitempty"`
+}
+
+type AttachmentsConfig struct {
+	// Multimodal backends get images and PDFs as attachments
+	Multimodal bool   `yaml:"multimodal"`
+	Flag       string `yaml:"flag,omitempty"`
+}
+
+type FilesConfig struct {
+	MaxFiles       int `yaml:"max_files,omitempty"`
+	MaxTotalSizeKB int `yaml:"max_total_size_kb,omitempty"`
+}
+
+type CompactionConfig struct {
+	Enabled   *bool   `yaml:"enabled,omitempty"`
+	MaxTokens int     `yaml:"max_tokens,omitempty"`
+	Threshold float64 `yaml:"threshold,omitempty"`
+	KeepTurns *int    `yaml:"keep_turns,omitempty"`
+	Role      string  `yaml:"role,omitempty"`
+}
+
+type SessionsConfig struct {
+	IsolateClients *bool `yaml:"isolate_clients,omitempty"`
+}
+
+type LimitsConfig struct {
+	Global LimitConfig            `yaml:"global,omitempty"`
+	Tools  map[string]LimitConfig `yaml:"tools,omitempty"`
+}
+
+type LimitConfig struct {
+	MaxConcurrent     int           `yaml:"max_concurrent,omitempty"`
+	RequestsPerMinute int           `yaml:"requests_per_minute,omitempty"`
+	MaxWait           time.Duration `yaml:"max_wait,omitempty"`
+}
+
+type AuditConfig struct {
+	Enabled    *bool  `yaml:"enabled,omitempty"`
+	Path       string `yaml:"path,omitempty"`
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+	MaxBackups *int   `yaml:"max_backups,omitempty"`
+}
+
+type RedactionConfig struct {
+	Enabled     *bool    `yaml:"enabled,omitempty"`
+	HighEntropy *bool    `yaml:"high_entropy,omitempty"`
+	Patterns    []string `yaml:"patterns,omitempty"`
+}
+
+type RootsConfig struct {
+	Enforce bool     `yaml:"enforce"`
+	Extra   []string `yaml:"extra,omitempty"`
+}
+
+type ExecConfig struct {
+	AllowedRoots []string  `yaml:"allowed_roots,omitempty"`
+	Env          EnvConfig `yaml:"env"`
+	MaxStdinKB   int       `yaml:"max_stdin_kb,omitempty"`
+}
+
+type EnvConfig struct {
+	Deny  []string `yaml:"deny"`
+	Allow []string `yaml:"allow,omitempty"`
 }
 
 type ToolConfig struct {
 	Description     Description      `yaml:"description"`
 	LogwormSettings *LogwormSettings `yaml:"settings,omitempty"`
+	Budget          *BudgetConfig    `yaml:"budget,omitempty"`
+	// ContextFormat frames files and command output: xml, markdown or json
+	ContextFormat string `yaml:"context_format,omitempty"`
+}
+
+type BudgetConfig struct {
+	// MaxTokens of 0 disables the budget
+	MaxTokens *int   `yaml:"max_tokens,omitempty"`
+	Estimator string `yaml:"estimator,omitempty"`
 }
 
 type LogwormSettings struct {
@@ -30,11 +134,35 @@ type Description struct {
 }
 
 const (
-	configDirName  = "modagent"
-	configFileName = "config.yaml"
+	configDirName        = "modagent"
+	configFileName       = "config.yaml"
+	auditFileName        = "audit.jsonl"
+	conversationsDirName = "conversations"
+	jobsDirName          = "jobs"
+
+	defaultAuditMaxSizeMB  = 10
+	defaultAuditMaxBackups = 5
+
+	defaultCompactionMaxTokens = 100000
+	defaultCompactionThreshold = 0.8
+	defaultCompactionKeepTurns = 2
+
+	defaultFilesMaxFiles       = 200
+	defaultFilesMaxTotalSizeKB = 2048
+
+	defaultBudgetMaxTokens = 100000
+
+	defaultExecMaxStdinKB = 1024
+
+	defaultArtifactsMaxAge          = 7 * 24 * time.Hour
+	defaultArtifactsMaxTotalSizeMB  = 1024
+	defaultArtifactsCleanupInterval = time.Hour
 )
 
-var validToolNames = []string{"junior-r", "junior-rwx", "logworm"}
+// budgetedTools get the default context budget unless configured otherwise.
+var budgetedTools = []string{"junior-r", "junior-rwx", "junior-panel", "logworm"}
+
+var validToolNames = []string{"junior-r", "junior-rwx", "junior-panel", "logworm", "conversations", "job_status", "job_result", "job_cancel", "job_list"}
 
 func LoadConfig() (*Config, error) {
 	configPath := filepath.Join(xdg.ConfigHome, configDirName, configFileName)
@@ -70,11 +198,111 @@ func validateConfig(cfg *Config) error {
 		validTools[tool] = true
 	}
 
+	if cfg.Exec != nil {
+		if cfg.Exec.MaxStdinKB < 0 {
+			return fmt.Errorf("exec: max_stdin_kb must not be negative")
+		}
+		for _, root := range cfg.Exec.AllowedRoots {
+			if !filepath.IsAbs(expandHome(root)) {
+				return fmt.Errorf("exec: allowed root must be an absolute path: %s", root)
+			}
+		}
+	}
+
+	if cfg.Roots != nil {
+		for _, extra := range cfg.Roots.Extra {
+			if !filepath.IsAbs(expandHome(extra)) {
+				return fmt.Errorf("roots: extra location must be an absolute path: %s", extra)
+			}
+		}
+	}
+
+	if cfg.Audit != nil {
+		if cfg.Audit.MaxSizeMB < 0 {
+			return fmt.Errorf("audit: max_size_mb must not be negative")
+		}
+		if cfg.Audit.MaxBackups != nil && *cfg.Audit.MaxBackups < 0 {
+			return fmt.Errorf("audit: max_backups must not be negative")
+		}
+		if cfg.Audit.Path != "" && !filepath.IsAbs(expandHome(cfg.Audit.Path)) {
+			return fmt.Errorf("audit: path must be absolute: %s", cfg.Audit.Path)
+		}
+	}
+
+	if cfg.Limits != nil {
+		if err := validateLimit("global", cfg.Limits.Global); err != nil {
+			return err
+		}
+		for toolName, limit := range cfg.Limits.Tools {
+			if !validTools[toolName] {
+				return fmt.Errorf("limits: unknown tool name: %s (valid tools: %v)", toolName, validToolNames)
+			}
+			if err := validateLimit(toolName, limit); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cfg.Compaction != nil {
+		if cfg.Compaction.MaxTokens < 0 {
+			return fmt.Errorf("compaction: max_tokens must not be negative")
+		}
+		if cfg.Compaction.Threshold < 0 || cfg.Compaction.Threshold > 1 {
+			return fmt.Errorf("compaction: threshold must be between 0 and 1")
+		}
+		if cfg.Compaction.KeepTurns != nil && *cfg.Compaction.KeepTurns < 0 {
+			return fmt.Errorf("compaction: keep_turns must not be negative")
+		}
+	}
+
+	if cfg.Files != nil && (cfg.Files.MaxFiles < 0 || cfg.Files.MaxTotalSizeKB < 0) {
+		return fmt.Errorf("files: limits must not be negative")
+	}
+
+	if cfg.Attachments != nil {
+		if cfg.Attachments.Flag != "" && !strings.HasPrefix(cfg.Attachments.Flag, "-") {
+			return fmt.Errorf("attachments: flag must start with \"-\": %s", cfg.Attachments.Flag)
+		}
+		if cfg.Attachments.Multimodal && cfg.Attachments.Flag == "" {
+			return fmt.Errorf("attachments: multimodal needs the flag that attaches files in your mods build")
+		}
+	}
+
+	if cfg.Artifacts != nil {
+		if cfg.Artifacts.MaxAge < 0 || cfg.Artifacts.MaxTotalSizeMB < 0 || cfg.Artifacts.CleanupInterval < 0 {
+			return fmt.Errorf("artifacts: values must not be negative")
+		}
+		if cfg.Artifacts.Dir != "" && !filepath.IsAbs(expandHome(cfg.Artifacts.Dir)) {
+			return fmt.Errorf("artifacts: dir must be absolute: %s", cfg.Artifacts.Dir)
+		}
+	}
+
+	if _, err := core.NewRedactor(cfg.GetRedactionPolicy()); err != nil {
+		return fmt.Errorf("redaction: %w", err)
+	}
+
 	for toolName, toolConfig := range cfg.Tools {
 		if !validTools[toolName] {
 			return fmt.Errorf("unknown tool name in config: %s (valid tools: %v)", toolName, validToolNames)
 		}
 
+		if budget := toolConfig.Budget; budget != nil {
+			if budget.MaxTokens != nil && *budget.MaxTokens < 0 {
+				return fmt.Errorf("tool %s: budget max_tokens must not be negative", toolName)
+			}
+			if budget.Estimator != "" {
+				if _, err := core.NewEstimator(budget.Estimator); err != nil {
+					return fmt.Errorf("tool %s: %w", toolName, err)
+				}
+			}
+		}
+
+		if toolConfig.ContextFormat != "" {
+			if err := core.ValidateContextFormat(toolConfig.ContextFormat); err != nil {
+				return fmt.Errorf("tool %s: %w", toolName, err)
+			}
+		}
+
 		// Validate mutually exclusive text/path
 		desc := toolConfig.Description
 		if desc.Text != nil && desc.Path != nil {
@@ -96,6 +324,13 @@ func validateConfig(cfg *Config) error {
 	return nil
 }
 
+func validateLimit(name string, limit LimitConfig) error {
+	if limit.MaxConcurrent < 0 || limit.RequestsPerMinute < 0 || limit.MaxWait < 0 {
+		return fmt.Errorf("limits: %s: values must not be negative", name)
+	}
+	return nil
+}
+
 func GenerateDefaultConfig() error {
 	configDir := filepath.Join(xdg.ConfigHome, configDirName)
 	configPath := filepath.Join(configDir, configFileName)
@@ -106,7 +341,13 @@ func GenerateDefaultConfig() error {
 
 	juniorRDesc := junior.Description + " (read-only mode)"
 	juniorRWXDesc := junior.Description + " (full access mode)"
+	juniorPanelDesc := junior.PanelDescription
 	logwormDesc := logworm.Description
+	conversationsDesc := conversation.Description
+	jobStatusDesc := jobs.StatusDescription
+	jobResultDesc := jobs.ResultDescription
+	jobCancelDesc := jobs.CancelDescription
+	jobListDesc := jobs.ListDescription
 
 	defaultConfig := Config{
 		Tools: map[string]ToolConfig{
@@ -120,6 +361,11 @@ func GenerateDefaultConfig() error {
 					Text: &juniorRWXDesc,
 				},
 			},
+			"junior-panel": {
+				Description: Description{
+					Text: &juniorPanelDesc,
+				},
+			},
 			"logworm": {
 				Description: Description{
 					Text: &logwormDesc,
@@ -128,6 +374,36 @@ func GenerateDefaultConfig() error {
 					PassthroughThreshold: 2000,
 				},
 			},
+			"conversations": {
+				Description: Description{
+					Text: &conversationsDesc,
+				},
+			},
+			"job_status": {
+				Description: Description{
+					Text: &jobStatusDesc,
+				},
+			},
+			"job_result": {
+				Description: Description{
+					Text: &jobResultDesc,
+				},
+			},
+			"job_cancel": {
+				Description: Description{
+					Text: &jobCancelDesc,
+				},
+			},
+			"job_list": {
+				Description: Description{
+					Text: &jobListDesc,
+				},
+			},
+		},
+		Exec: &ExecConfig{
+			Env: EnvConfig{
+				Deny: core.DefaultEnvDeny,
+			},
 		},
 	}
 
@@ -183,3 +459,228 @@ func (c *Config) GetLogwormPassthroughThreshold() int {
 	}
 	return 2000 // default value
 }
+
+func (c *Config) GetExecPolicy() core.ExecPolicy {
+	if c.Exec == nil {
+		return core.ExecPolicy{EnvDeny: core.DefaultEnvDeny, MaxStdin: defaultExecMaxStdinKB << 10}
+	}
+	policy := core.ExecPolicy{
+		EnvDeny:  c.Exec.Env.Deny,
+		EnvAllow: c.Exec.Env.Allow,
+		MaxStdin: defaultExecMaxStdinKB << 10,
+	}
+	if c.Exec.MaxStdinKB > 0 {
+		policy.MaxStdin = int64(c.Exec.MaxStdinKB) << 10
+	}
+	if policy.EnvDeny == nil {
+		policy.EnvDeny = core.DefaultEnvDeny
+	}
+	for _, root := range c.Exec.AllowedRoots {
+		policy.AllowedRoots = append(policy.AllowedRoots, filepath.Clean(expandHome(root)))
+	}
+	return policy
+}
+
+func (c *Config) GetRootsPolicy() core.RootsPolicy {
+	if c.Roots == nil {
+		return core.RootsPolicy{}
+	}
+	policy := core.RootsPolicy{Enforce: c.Roots.Enforce}
+	for _, extra := range c.Roots.Extra {
+		policy.Extra = append(policy.Extra, filepath.Clean(expandHome(extra)))
+	}
+	return policy
+}
+
+func (c *Config) GetRedactionPolicy() core.RedactionPolicy {
+	// High-entropy masking is opt-in: it also hits checksums, base64
+	// payloads and the like, which are rarely secret
+	policy := core.RedactionPolicy{Enabled: true}
+	if c.Redaction == nil {
+		return policy
+	}
+	if c.Redaction.Enabled != nil {
+		policy.Enabled = *c.Redaction.Enabled
+	}
+	if c.Redaction.HighEntropy != nil {
+		policy.HighEntropy = *c.Redaction.HighEntropy
+	}
+	policy.Patterns = c.Redaction.Patterns
+	return policy
+}
+
+// GetAuditSettings returns the audit log settings and whether auditing is
+// enabled.
+func (c *Config) GetAuditSettings() (audit.Settings, bool) {
+	settings := audit.Settings{
+		Path:       filepath.Join(xdg.StateHome, configDirName, auditFileName),
+		MaxSize:    defaultAuditMaxSizeMB << 20,
+		MaxBackups: defaultAuditMaxBackups,
+	}
+	if c.Audit == nil {
+		return settings, true
+	}
+	if c.Audit.Path != "" {
+		settings.Path = expandHome(c.Audit.Path)
+	}
+	if c.Audit.MaxSizeMB > 0 {
+		settings.MaxSize = int64(c.Audit.MaxSizeMB) << 20
+	}
+	if c.Audit.MaxBackups != nil {
+		settings.MaxBackups = *c.Audit.MaxBackups
+	}
+	return settings, c.Audit.Enabled == nil || *c.Audit.Enabled
+}
+
+func (c *Config) GetLimiter() *limits.Limiter {
+	if c.Limits == nil {
+		return limits.New(limits.Limit{}, nil)
+	}
+	tools := make(map[string]limits.Limit, len(c.Limits.Tools))
+	for toolName, limit := range c.Limits.Tools {
+		tools[toolName] = limits.Limit(limit)
+	}
+	return limits.New(limits.Limit(c.Limits.Global), tools)
+}
+
+func (c *Config) GetIsolateClients() bool {
+	if c.Sessions == nil || c.Sessions.IsolateClients == nil {
+		return true
+	}
+	return *c.Sessions.IsolateClients
+}
+
+func (c *Config) GetCompactionPolicy() core.CompactionPolicy {
+	policy := core.CompactionPolicy{
+		Enabled:   true,
+		MaxTokens: defaultCompactionMaxTokens,
+		Threshold: defaultCompactionThreshold,
+		KeepTurns: defaultCompactionKeepTurns,
+	}
+	if c.Compaction == nil {
+		return policy
+	}
+	if c.Compaction.Enabled != nil {
+		policy.Enabled = *c.Compaction.Enabled
+	}
+	if c.Compaction.MaxTokens > 0 {
+		policy.MaxTokens = c.Compaction.MaxTokens
+	}
+	if c.Compaction.Threshold > 0 {
+		policy.Threshold = c.Compaction.Threshold
+	}
+	if c.Compaction.KeepTurns != nil {
+		policy.KeepTurns = *c.Compaction.KeepTurns
+	}
+	policy.Role = c.Compaction.Role
+	return policy
+}
+
+func (c *Config) GetFilesPolicy() core.FilesPolicy {
+	policy := core.FilesPolicy{
+		MaxFiles:     defaultFilesMaxFiles,
+		MaxTotalSize: defaultFilesMaxTotalSizeKB << 10,
+	}
+	if c.Files == nil {
+		return policy
+	}
+	if c.Files.MaxFiles > 0 {
+		policy.MaxFiles = c.Files.MaxFiles
+	}
+	if c.Files.MaxTotalSizeKB > 0 {
+		policy.MaxTotalSize = int64(c.Files.MaxTotalSizeKB) << 10
+	}
+	return policy
+}
+
+func (c *Config) GetAttachmentsPolicy() core.AttachmentsPolicy {
+	if c.Attachments == nil {
+		return core.AttachmentsPolicy{}
+	}
+	return core.AttachmentsPolicy{Multimodal: c.Attachments.Multimodal, Flag: c.Attachments.Flag}
+}
+
+// GetBudgets returns the context budget of each tool.
+func (c *Config) GetBudgets() map[string]core.Budget {
+	budgets := make(map[string]core.Budget)
+	for _, toolName := range budgetedTools {
+		budgets[toolName] = core.Budget{MaxTokens: defaultBudgetMaxTokens, Estimator: core.DefaultEstimator}
+	}
+	for toolName, toolConfig := range c.Tools {
+		config := toolConfig.Budget
+		if config == nil {
+			continue
+		}
+		budget := budgets[toolName]
+		if config.MaxTokens != nil {
+			budget.MaxTokens = *config.MaxTokens
+		}
+		if config.Estimator != "" {
+			// Validated on load
+			budget.Estimator, _ = core.NewEstimator(config.Estimator)
+		}
+		budgets[toolName] = budget
+	}
+	return budgets
+}
+
+// GetContextFormats returns the configured context format of each tool.
+func (c *Config) GetContextFormats() map[string]string {
+	formats := make(map[string]string)
+	for toolName, toolConfig := range c.Tools {
+		if toolConfig.ContextFormat != "" {
+			formats[toolName] = toolConfig.ContextFormat
+		}
+	}
+	return formats
+}
+
+// GetArtifactsDir returns the directory bash command output is saved in.
+func (c *Config) GetArtifactsDir() string {
+	if c.Artifacts != nil && c.Artifacts.Dir != "" {
+		return expandHome(c.Artifacts.Dir)
+	}
+	return artifacts.DefaultRoot()
+}
+
+// GetArtifactsPolicy returns the retention policy of artifacts and whether
+// they are cleaned up in the background.
+func (c *Config) GetArtifactsPolicy() (artifacts.Policy, bool) {
+	policy := artifacts.Policy{
+		MaxAge:          defaultArtifactsMaxAge,
+		MaxTotalSize:    defaultArtifactsMaxTotalSizeMB << 20,
+		CleanupInterval: defaultArtifactsCleanupInterval,
+	}
+	if c.Artifacts == nil {
+		return policy, true
+	}
+	if c.Artifacts.MaxAge > 0 {
+		policy.MaxAge = c.Artifacts.MaxAge
+	}
+	if c.Artifacts.MaxTotalSizeMB > 0 {
+		policy.MaxTotalSize = int64(c.Artifacts.MaxTotalSizeMB) << 20
+	}
+	if c.Artifacts.CleanupInterval > 0 {
+		policy.CleanupInterval = c.Artifacts.CleanupInterval
+	}
+	return policy, c.Artifacts.Cleanup == nil || *c.Artifacts.Cleanup
+}
+
+func (c *Config) GetConversationsDir() string {
+	return filepath.Join(xdg.DataHome, configDirName, conversationsDirName)
+}
+
+func (c *Config) GetJobsDir() string {
+	return filepath.Join(xdg.DataHome, configDirName, jobsDirName)
+}
+
+// expandHome replaces a leading "~" with the user's home directory.
+func expandHome(path string) string {
+	if path == "~" {
+		return xdg.Home
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(xdg.Home, rest)
+	}
+	return path
+}
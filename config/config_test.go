@@ -4,7 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/adrg/xdg"
+	"github.com/anuramat/modagent/core"
 	"github.com/anuramat/modagent/testutils"
 )
 
@@ -131,7 +134,7 @@ func TestGenerateDefaultConfig(t *testing.T) {
 	// Load and validate generated config
 	cfg, err := LoadConfig()
 	testutils.AssertNoError(t, err)
-	testutils.AssertEqual(t, 3, len(cfg.Tools))
+	testutils.AssertEqual(t, 9, len(cfg.Tools))
 
 	// Check all tools are present
 	for _, toolName := range validToolNames {
@@ -222,3 +225,194 @@ func TestGetToolDescriptionFileReadError(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestGetExecPolicy(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	policy := cfg.GetExecPolicy()
+	testutils.AssertEqual(t, len(core.DefaultEnvDeny), len(policy.EnvDeny))
+	testutils.AssertEqual(t, 0, len(policy.AllowedRoots))
+	testutils.AssertEqual(t, int64(1024<<10), policy.MaxStdin)
+
+	cfg.Exec = &ExecConfig{
+		AllowedRoots: []string{"~/src", "/srv/repos/"},
+		Env:          EnvConfig{Deny: []string{"SECRET"}, Allow: []string{"GH_TOKEN"}},
+		MaxStdinKB:   8,
+	}
+	policy = cfg.GetExecPolicy()
+	testutils.AssertEqual(t, filepath.Join(xdg.Home, "src"), policy.AllowedRoots[0])
+	testutils.AssertEqual(t, "/srv/repos", policy.AllowedRoots[1])
+	testutils.AssertEqual(t, "SECRET", policy.EnvDeny[0])
+	testutils.AssertEqual(t, "GH_TOKEN", policy.EnvAllow[0])
+	testutils.AssertEqual(t, int64(8<<10), policy.MaxStdin)
+}
+
+func TestValidateConfigExec(t *testing.T) {
+	cfg := &Config{
+		Tools: make(map[string]ToolConfig),
+		Exec:  &ExecConfig{AllowedRoots: []string{"relative/dir"}},
+	}
+	testutils.AssertError(t, validateConfig(cfg))
+}
+
+func TestGetAuditSettings(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	settings, enabled := cfg.GetAuditSettings()
+	testutils.AssertEqual(t, true, enabled)
+	testutils.AssertEqual(t, filepath.Join(xdg.StateHome, "modagent", "audit.jsonl"), settings.Path)
+
+	disabled := false
+	backups := 0
+	cfg.Audit = &AuditConfig{Enabled: &disabled, Path: "/var/log/modagent.jsonl", MaxSizeMB: 1, MaxBackups: &backups}
+	settings, enabled = cfg.GetAuditSettings()
+	testutils.AssertEqual(t, false, enabled)
+	testutils.AssertEqual(t, "/var/log/modagent.jsonl", settings.Path)
+	testutils.AssertEqual(t, int64(1<<20), settings.MaxSize)
+	testutils.AssertEqual(t, 0, settings.MaxBackups)
+}
+
+func TestLoadConfigLimits(t *testing.T) {
+	configDir, cleanup := testutils.SetupTestConfig(t)
+	defer cleanup()
+
+	testutils.WriteTestConfig(t, configDir, `tools: {}
+limits:
+  global:
+    max_concurrent: 4
+  tools:
+    junior-rwx:
+      max_concurrent: 1
+      requests_per_minute: 10
+      max_wait: 90s`)
+
+	cfg, err := LoadConfig()
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 4, cfg.Limits.Global.MaxConcurrent)
+	testutils.AssertEqual(t, 90*time.Second, cfg.Limits.Tools["junior-rwx"].MaxWait)
+	testutils.AssertEqual(t, true, cfg.GetLimiter().Enabled())
+
+	testutils.WriteTestConfig(t, configDir, `limits:
+  tools:
+    unknown:
+      max_concurrent: 1`)
+	_, err = LoadConfig()
+	testutils.AssertError(t, err)
+}
+
+func TestGetCompactionPolicy(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	policy := cfg.GetCompactionPolicy()
+	testutils.AssertEqual(t, true, policy.Enabled)
+	testutils.AssertEqual(t, 100000, policy.MaxTokens)
+	testutils.AssertEqual(t, 2, policy.KeepTurns)
+
+	keep := 0
+	cfg.Compaction = &CompactionConfig{MaxTokens: 8000, Threshold: 0.5, KeepTurns: &keep, Role: "summariser"}
+	policy = cfg.GetCompactionPolicy()
+	testutils.AssertEqual(t, 8000, policy.MaxTokens)
+	testutils.AssertEqual(t, 0.5, policy.Threshold)
+	testutils.AssertEqual(t, 0, policy.KeepTurns)
+	testutils.AssertEqual(t, "summariser", policy.Role)
+	testutils.AssertNoError(t, validateConfig(cfg))
+
+	cfg.Compaction.Threshold = 1.5
+	testutils.AssertError(t, validateConfig(cfg))
+}
+
+func TestGetFilesPolicy(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	policy := cfg.GetFilesPolicy()
+	testutils.AssertEqual(t, 200, policy.MaxFiles)
+	testutils.AssertEqual(t, int64(2<<20), policy.MaxTotalSize)
+
+	cfg.Files = &FilesConfig{MaxFiles: 10, MaxTotalSizeKB: 64}
+	policy = cfg.GetFilesPolicy()
+	testutils.AssertEqual(t, 10, policy.MaxFiles)
+	testutils.AssertEqual(t, int64(64<<10), policy.MaxTotalSize)
+
+	cfg.Files.MaxFiles = -1
+	testutils.AssertError(t, validateConfig(cfg))
+}
+
+func TestGetBudgets(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	budgets := cfg.GetBudgets()
+	testutils.AssertEqual(t, 100000, budgets["junior-r"].MaxTokens)
+	testutils.AssertEqual(t, 100000, budgets["junior-panel"].MaxTokens)
+	testutils.AssertEqual(t, 0, budgets["conversations"].MaxTokens)
+
+	unlimited := 0
+	cfg.Tools["junior-rwx"] = ToolConfig{Budget: &BudgetConfig{Estimator: "anthropic"}}
+	cfg.Tools["logworm"] = ToolConfig{Budget: &BudgetConfig{MaxTokens: &unlimited}}
+	testutils.AssertNoError(t, validateConfig(cfg))
+	budgets = cfg.GetBudgets()
+	testutils.AssertEqual(t, 100000, budgets["junior-rwx"].MaxTokens)
+	testutils.AssertEqual(t, "anthropic", budgets["junior-rwx"].Estimator.Backend)
+	testutils.AssertEqual(t, 0, budgets["logworm"].MaxTokens)
+
+	cfg.Tools["junior-r"] = ToolConfig{Budget: &BudgetConfig{Estimator: "unknown"}}
+	testutils.AssertError(t, validateConfig(cfg))
+}
+
+func TestGetContextFormats(t *testing.T) {
+	cfg := &Config{Tools: map[string]ToolConfig{
+		"junior-r": {ContextFormat: "markdown"},
+		"logworm":  {},
+	}}
+	testutils.AssertNoError(t, validateConfig(cfg))
+	formats := cfg.GetContextFormats()
+	testutils.AssertEqual(t, "markdown", formats["junior-r"])
+	_, ok := formats["logworm"]
+	testutils.AssertEqual(t, false, ok)
+
+	cfg.Tools["logworm"] = ToolConfig{ContextFormat: "yaml"}
+	testutils.AssertError(t, validateConfig(cfg))
+}
+
+func TestGetRedactionPolicy(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	policy := cfg.GetRedactionPolicy()
+	testutils.AssertEqual(t, true, policy.Enabled)
+	testutils.AssertEqual(t, false, policy.HighEntropy)
+
+	enabled := true
+	cfg.Redaction = &RedactionConfig{HighEntropy: &enabled}
+	testutils.AssertEqual(t, true, cfg.GetRedactionPolicy().HighEntropy)
+}
+
+func TestGetAttachmentsPolicy(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	policy := cfg.GetAttachmentsPolicy()
+	testutils.AssertEqual(t, false, policy.Multimodal)
+	testutils.AssertEqual(t, "", policy.Flag)
+
+	cfg.Attachments = &AttachmentsConfig{Multimodal: true, Flag: "--image"}
+	testutils.AssertNoError(t, validateConfig(cfg))
+	policy = cfg.GetAttachmentsPolicy()
+	testutils.AssertEqual(t, true, policy.Multimodal)
+	testutils.AssertEqual(t, "--image", policy.Flag)
+
+	cfg.Attachments.Flag = "image"
+	testutils.AssertError(t, validateConfig(cfg))
+
+	cfg.Attachments.Flag = ""
+	testutils.AssertError(t, validateConfig(cfg))
+}
+
+func TestGetArtifactsPolicy(t *testing.T) {
+	cfg := &Config{Tools: make(map[string]ToolConfig)}
+	policy, enabled := cfg.GetArtifactsPolicy()
+	testutils.AssertEqual(t, true, enabled)
+	testutils.AssertEqual(t, 7*24*time.Hour, policy.MaxAge)
+	testutils.AssertEqual(t, int64(1024<<20), policy.MaxTotalSize)
+
+	disabled := false
+	cfg.Artifacts = &ArtifactsConfig{Dir: "/var/tmp/modagent", Cleanup: &disabled, MaxAge: time.Hour}
+	testutils.AssertNoError(t, validateConfig(cfg))
+	policy, enabled = cfg.GetArtifactsPolicy()
+	testutils.AssertEqual(t, false, enabled)
+	testutils.AssertEqual(t, time.Hour, policy.MaxAge)
+	testutils.AssertEqual(t, "/var/tmp/modagent", cfg.GetArtifactsDir())
+
+	cfg.Artifacts.Dir = "relative"
+	testutils.AssertError(t, validateConfig(cfg))
+}
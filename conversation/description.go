@@ -0,0 +1,6 @@
+package conversation
+
+import _ "embed"
+
+//go:embed description.md
+var Description string
@@ -0,0 +1,267 @@
+package conversation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anuramat/modagent/framing"
+)
+
+const (
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+
+	exportKind    = "modagent-conversation"
+	exportVersion = 1
+
+	markdownHeader     = "<!-- modagent:conversation "
+	markdownTurnHeader = "<!-- modagent:turn "
+	markdownComment    = " -->"
+)
+
+// exportEnvelope is the JSON export format.
+type exportEnvelope struct {
+	Kind         string        `json:"kind"`
+	Version      int           `json:"version"`
+	Conversation *Conversation `json:"conversation"`
+}
+
+// conversationMeta and turnMeta carry everything but the text sections in
+// the Markdown export, so that it can be imported losslessly.
+type conversationMeta struct {
+	Version  int       `json:"version"`
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Name     string    `json:"name,omitempty"`
+	Tool     string    `json:"tool,omitempty"`
+	Parent   string    `json:"parent,omitempty"`
+	ForkedAt int       `json:"forked_at,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	// Compaction keeps the summary the model sees in place of early turns
+	Compaction *Compaction `json:"compaction,omitempty"`
+}
+
+type turnMeta struct {
+	Time    time.Time `json:"time"`
+	Role    string    `json:"role,omitempty"`
+	Files   []string  `json:"files,omitempty"`
+	BashCmd string    `json:"bash_cmd,omitempty"`
+}
+
+// Export renders the conversation, including the injected context of every
+// turn, in the given format. Both formats can be read back with Import.
+func (c *Conversation) Export(format string) ([]byte, error) {
+	switch format {
+	case FormatMarkdown, "md", "":
+		return []byte(c.exportMarkdown()), nil
+	case FormatJSON:
+		return json.MarshalIndent(exportEnvelope{Kind: exportKind, Version: exportVersion, Conversation: c}, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown export format %q (valid: %s, %s)", format, FormatMarkdown, FormatJSON)
+	}
+}
+
+func (c *Conversation) exportMarkdown() string {
+	var b strings.Builder
+	// json.Marshal escapes '>', so the metadata can't terminate the comment
+	meta, _ := json.Marshal(conversationMeta{
+		Version:    exportVersion,
+		ID:         c.ID,
+		Title:      c.Title,
+		Name:       c.Name,
+		Tool:       c.Tool,
+		Parent:     c.Parent,
+		ForkedAt:   c.ForkedAt,
+		Created:    c.Created,
+		Updated:    c.Updated,
+		Compaction: c.Compaction,
+	})
+	fmt.Fprintf(&b, "%s%s%s\n# %s\n\n", markdownHeader, meta, markdownComment, c.Title)
+	if c.Parent != "" {
+		fmt.Fprintf(&b, "Forked from %s at turn %d.\n\n", c.Parent, c.ForkedAt)
+	}
+	for i, turn := range c.Turns {
+		meta, _ := json.Marshal(turnMeta{Time: turn.Time, Role: turn.Role, Files: turn.Files, BashCmd: turn.BashCmd})
+		fmt.Fprintf(&b, "## Turn %d (%s)\n\n%s%s%s\n\n", i+1, turn.Time.Format(time.RFC3339), markdownTurnHeader, meta, markdownComment)
+		if turn.BashCmd != "" {
+			fmt.Fprintf(&b, "Command: `%s`\n\n", turn.BashCmd)
+		}
+		if len(turn.Files) > 0 {
+			fmt.Fprintf(&b, "Files: %s\n\n", strings.Join(turn.Files, ", "))
+		}
+		writeSection(&b, "Prompt", turn.Prompt)
+		if turn.Context != "" {
+			writeSection(&b, "Context", turn.Context)
+		}
+		writeSection(&b, "Response", turn.Response)
+	}
+	return b.String()
+}
+
+// writeSection writes text in a fence longer than any backtick run inside
+// it, so that the content can't close the fence early.
+func writeSection(b *strings.Builder, heading, text string) {
+	fence := framing.Fence(text)
+	fmt.Fprintf(b, "### %s\n\n%s\n%s\n%s\n\n", heading, fence, text, fence)
+}
+
+// Import parses a conversation exported as Markdown or JSON.
+func Import(data []byte) (*Conversation, error) {
+	var c *Conversation
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		c, err = importJSON(trimmed)
+	} else {
+		c, err = importMarkdown(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Turns) == 0 {
+		return nil, fmt.Errorf("conversation has no turns")
+	}
+	return c, nil
+}
+
+func importJSON(data []byte) (*Conversation, error) {
+	var envelope exportEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid JSON export: %w", err)
+	}
+	if envelope.Kind != exportKind || envelope.Conversation == nil {
+		return nil, fmt.Errorf("not a modagent conversation export")
+	}
+	if envelope.Version > exportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", envelope.Version)
+	}
+	return envelope.Conversation, nil
+}
+
+func importMarkdown(data []byte) (*Conversation, error) {
+	var c *Conversation
+	var turn *Turn
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		switch {
+		case c == nil:
+			meta, ok := strings.CutPrefix(text, markdownHeader)
+			if !ok {
+				continue
+			}
+			var m conversationMeta
+			if err := unmarshalComment(meta, &m); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if m.Version > exportVersion {
+				return nil, fmt.Errorf("unsupported export version %d", m.Version)
+			}
+			c = &Conversation{
+				ID:         m.ID,
+				Title:      m.Title,
+				Name:       m.Name,
+				Tool:       m.Tool,
+				Parent:     m.Parent,
+				ForkedAt:   m.ForkedAt,
+				Created:    m.Created,
+				Updated:    m.Updated,
+				Compaction: m.Compaction,
+			}
+		case strings.HasPrefix(text, markdownTurnHeader):
+			var m turnMeta
+			if err := unmarshalComment(strings.TrimPrefix(text, markdownTurnHeader), &m); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			c.Turns = append(c.Turns, Turn{Time: m.Time, Role: m.Role, Files: m.Files, BashCmd: m.BashCmd})
+			turn = &c.Turns[len(c.Turns)-1]
+		case strings.HasPrefix(text, "### ") && turn != nil:
+			var field *string
+			switch strings.TrimPrefix(text, "### ") {
+			case "Prompt":
+				field = &turn.Prompt
+			case "Context":
+				field = &turn.Context
+			case "Response":
+				field = &turn.Response
+			default:
+				continue
+			}
+			content, err := readSection(scanner, &line)
+			if err != nil {
+				return nil, err
+			}
+			*field = content
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("not a modagent conversation export")
+	}
+	return c, nil
+}
+
+func unmarshalComment(text string, v any) error {
+	text, ok := strings.CutSuffix(text, markdownComment)
+	if !ok {
+		return fmt.Errorf("unterminated metadata comment")
+	}
+	if err := json.Unmarshal([]byte(text), v); err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+	return nil
+}
+
+// readSection reads a fenced block written by writeSection.
+func readSection(scanner *bufio.Scanner, line *int) (string, error) {
+	fence := ""
+	for fence == "" && scanner.Scan() {
+		*line++
+		fence = scanner.Text()
+	}
+	if len(fence) < 3 || strings.Trim(fence, "`") != "" {
+		return "", fmt.Errorf("line %d: expected a code fence", *line)
+	}
+	var lines []string
+	for scanner.Scan() {
+		*line++
+		if scanner.Text() == fence {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, scanner.Text())
+	}
+	return "", fmt.Errorf("line %d: unterminated code fence", *line)
+}
+
+// Import stores an imported conversation in the scope. It keeps the original
+// ID unless that is taken, and drops the mods ID and any session name that
+// clashes, since neither carries over to another machine or project.
+func (s *Store) Import(scope Scope, c *Conversation) (*Conversation, error) {
+	if c.Name != "" {
+		if _, err := s.FindByName(scope, c.Name); err == nil {
+			c.Name = ""
+		}
+	}
+	c.Session = scope.Session
+	c.Project = scope.Project
+	c.ModsID = ""
+
+	s.mu.Lock()
+	if _, err := s.get(c.ID); err != ErrNotFound {
+		c.ID = NewID()
+	}
+	err := s.save(c)
+	s.mu.Unlock()
+
+	s.notify(Created, c, err)
+	return c, err
+}
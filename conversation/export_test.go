@@ -0,0 +1,101 @@
+package conversation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+func exportFixture() *Conversation {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	return &Conversation{
+		ID:      "conv",
+		Title:   "review <parser> --> flags",
+		Name:    "auth-refactor",
+		Tool:    "junior-r",
+		ModsID:  "mods-conv",
+		Created: now,
+		Updated: now.Add(time.Minute),
+		Turns: []Turn{
+			{
+				Time:     now,
+				Role:     "junior-r",
+				Prompt:   "what does ``` do?\n### Response\n",
+				Context:  "<file path=\"a.go\">\n````go\npackage a\n````\n</file>\n",
+				Response: "<!-- modagent:turn {} -->",
+				Files:    []string{"/src/a.go"},
+				BashCmd:  "echo '-->'",
+			},
+			{Time: now.Add(time.Minute), Prompt: "", Response: "done"},
+		},
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatMarkdown, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			original := exportFixture()
+			data, err := original.Export(format)
+			testutils.AssertNoError(t, err)
+
+			imported, err := Import(data)
+			testutils.AssertNoError(t, err)
+			testutils.AssertEqual(t, original.Title, imported.Title)
+			testutils.AssertEqual(t, original.Name, imported.Name)
+			testutils.AssertEqual(t, len(original.Turns), len(imported.Turns))
+			for i, turn := range original.Turns {
+				got := imported.Turns[i]
+				testutils.AssertEqual(t, turn.Prompt, got.Prompt)
+				testutils.AssertEqual(t, turn.Context, got.Context)
+				testutils.AssertEqual(t, turn.Response, got.Response)
+				testutils.AssertEqual(t, turn.BashCmd, got.BashCmd)
+				testutils.AssertEqual(t, strings.Join(turn.Files, ","), strings.Join(got.Files, ","))
+				testutils.AssertEqual(t, true, turn.Time.Equal(got.Time))
+			}
+		})
+	}
+}
+
+func TestImportRejectsInvalidInput(t *testing.T) {
+	markdown, err := exportFixture().Export(FormatMarkdown)
+	testutils.AssertNoError(t, err)
+	truncated := string(markdown[:strings.LastIndex(string(markdown), "done")])
+
+	for _, input := range []string{
+		"# just some notes",
+		`{"kind":"something-else","conversation":{}}`,
+		`{"kind":"modagent-conversation","version":99,"conversation":{"turns":[{}]}}`,
+		truncated,
+	} {
+		_, err := Import([]byte(input))
+		testutils.AssertError(t, err)
+	}
+	_, err = exportFixture().Export("yaml")
+	testutils.AssertError(t, err)
+}
+
+func TestStoreImport(t *testing.T) {
+	store := newTestStore(t)
+	appendTurns(t, store, "conv", "question")
+	scope := Scope{Session: "s1", Project: "/src/a"}
+
+	// The ID is taken, so the import gets a new one; the mods ID is dropped
+	c, err := store.Import(scope, exportFixture())
+	testutils.AssertNoError(t, err)
+	if c.ID == "conv" {
+		t.Fatal("Expected a new ID for a clashing import")
+	}
+	testutils.AssertEqual(t, "", c.ModsID)
+	testutils.AssertEqual(t, "auth-refactor", c.Name)
+
+	found, err := store.FindByName(scope, "auth-refactor")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, c.ID, found.ID)
+
+	// A second import of the same name doesn't steal it
+	again, err := store.Import(scope, exportFixture())
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "", again.Name)
+}
@@ -0,0 +1,213 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Methods of resource subscriptions; mcp-go doesn't dispatch them, so the
+// transport hands them to Subscribe and Unsubscribe.
+const (
+	MethodResourcesSubscribe   = "resources/subscribe"
+	MethodResourcesUnsubscribe = "resources/unsubscribe"
+)
+
+const (
+	ResourceURIPrefix   = "modagent://conversation/"
+	ResourceURITemplate = ResourceURIPrefix + "{id}"
+	resourceMIMEType    = "text/markdown"
+)
+
+func ResourceURI(id string) string {
+	return ResourceURIPrefix + id
+}
+
+// Publish exposes conversations as MCP resources: a template for direct
+// reads and one listed resource per conversation. Listings and reads are
+// limited to the scope of the client, i.e. its first root. Changes to the
+// list are announced with list_changed notifications, and changes to a
+// conversation with resources/updated to its subscribers. Conversations
+// bound to a client session are only listed for that session where the
+// transport supports it; hooks are used to publish them once the session
+// registers.
+func (s *Server) Publish(mcpServer *server.MCPServer, hooks *server.Hooks) error {
+	template := mcp.NewResourceTemplate(ResourceURITemplate, "conversation",
+		mcp.WithTemplateDescription("Transcript of a junior or logworm conversation"),
+		mcp.WithTemplateMIMEType(resourceMIMEType),
+	)
+	mcpServer.AddResourceTemplate(template, s.HandleRead)
+
+	conversations, err := s.store.ListAll()
+	if err != nil {
+		return fmt.Errorf("failed to list conversations: %w", err)
+	}
+	for _, c := range conversations {
+		if c.Session == "" {
+			mcpServer.AddResource(resource(c), s.HandleRead)
+		}
+	}
+
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		conversations, err := s.store.ListAll()
+		if err != nil {
+			return
+		}
+		for _, c := range conversations {
+			if c.Session == session.SessionID() {
+				s.publish(mcpServer, c)
+			}
+		}
+	})
+
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		s.unsubscribeSession(session.SessionID())
+	})
+
+	hooks.AddAfterListResources(func(ctx context.Context, id any, message *mcp.ListResourcesRequest, result *mcp.ListResourcesResult) {
+		result.Resources = s.visibleResources(ctx, result.Resources)
+	})
+
+	s.store.OnChange(func(kind ChangeKind, c *Conversation) {
+		switch kind {
+		case Created:
+			s.publish(mcpServer, c)
+		case Updated:
+			// Re-publishing refreshes the listed title and sends list_changed
+			s.publish(mcpServer, c)
+			s.notifySubscribers(mcpServer, ResourceURI(c.ID), false)
+		case Deleted:
+			if c.Session != "" {
+				_ = mcpServer.DeleteSessionResources(c.Session, ResourceURI(c.ID))
+			}
+			mcpServer.RemoveResource(ResourceURI(c.ID))
+			s.notifySubscribers(mcpServer, ResourceURI(c.ID), true)
+		}
+	})
+	return nil
+}
+
+func (s *Server) publish(mcpServer *server.MCPServer, c *Conversation) {
+	if c.Session != "" {
+		err := mcpServer.AddSessionResource(c.Session, resource(c), s.HandleRead)
+		if err != server.ErrSessionDoesNotSupportResources {
+			return
+		}
+		// Transports like stdio serve a single client, so global is fine
+	}
+	mcpServer.AddResource(resource(c), s.HandleRead)
+}
+
+// Subscribe asks for resources/updated notifications to the session when
+// the conversation changes. Reads are still checked against the scope of
+// the client.
+func (s *Server) Subscribe(sessionID, uri string) error {
+	id, ok := strings.CutPrefix(uri, ResourceURIPrefix)
+	if !ok || id == "" {
+		return fmt.Errorf("invalid conversation URI: %s", uri)
+	}
+	if _, err := s.store.Get(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subscribers[uri] == nil {
+		s.subscribers[uri] = make(map[string]bool)
+	}
+	s.subscribers[uri][sessionID] = true
+	return nil
+}
+
+// Unsubscribe undoes Subscribe.
+func (s *Server) Unsubscribe(sessionID, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers[uri], sessionID)
+	if len(s.subscribers[uri]) == 0 {
+		delete(s.subscribers, uri)
+	}
+}
+
+func (s *Server) unsubscribeSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uri, sessions := range s.subscribers {
+		delete(sessions, sessionID)
+		if len(sessions) == 0 {
+			delete(s.subscribers, uri)
+		}
+	}
+}
+
+// notifySubscribers sends resources/updated to the subscribers of uri; the
+// subscriptions of deleted conversations end with it.
+func (s *Server) notifySubscribers(mcpServer *server.MCPServer, uri string, deleted bool) {
+	s.mu.Lock()
+	var sessions []string
+	for sessionID := range s.subscribers[uri] {
+		sessions = append(sessions, sessionID)
+	}
+	if deleted {
+		delete(s.subscribers, uri)
+	}
+	s.mu.Unlock()
+
+	for _, sessionID := range sessions {
+		_ = mcpServer.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+	}
+}
+
+// visibleResources drops the conversations outside of the client's scope
+// from a resource listing.
+func (s *Server) visibleResources(ctx context.Context, resources []mcp.Resource) []mcp.Resource {
+	scope, err := s.resolveScope(ctx, "")
+	visible := resources[:0]
+	for _, r := range resources {
+		id, ok := strings.CutPrefix(r.URI, ResourceURIPrefix)
+		if !ok {
+			visible = append(visible, r)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, err := s.get(scope, id); err == nil {
+			visible = append(visible, r)
+		}
+	}
+	return visible
+}
+
+func resource(c *Conversation) mcp.Resource {
+	return mcp.NewResource(ResourceURI(c.ID), c.Title,
+		mcp.WithResourceDescription(fmt.Sprintf("%s conversation with %d turns", c.Tool, len(c.Turns))),
+		mcp.WithMIMEType(resourceMIMEType),
+	)
+}
+
+func (s *Server) HandleRead(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	id, ok := strings.CutPrefix(request.Params.URI, ResourceURIPrefix)
+	if !ok || id == "" {
+		return nil, fmt.Errorf("invalid conversation URI: %s", request.Params.URI)
+	}
+	// Resource reads carry no working directory; the client's root is used
+	scope, err := s.resolveScope(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.get(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      request.Params.URI,
+			MIMEType: resourceMIMEType,
+			Text:     c.Transcript(),
+		},
+	}, nil
+}
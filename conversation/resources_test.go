@@ -0,0 +1,153 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func listResources(t *testing.T, mcpServer *server.MCPServer) []mcp.Resource {
+	response := mcpServer.HandleMessage(context.Background(), json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`))
+	data, err := json.Marshal(response)
+	testutils.AssertNoError(t, err)
+	var parsed struct {
+		Result mcp.ListResourcesResult `json:"result"`
+	}
+	testutils.AssertNoError(t, json.Unmarshal(data, &parsed))
+	return parsed.Result.Resources
+}
+
+func TestPublish(t *testing.T) {
+	store := newTestStore(t)
+	appendTurns(t, store, "existing", "question")
+
+	mcpServer := server.NewMCPServer("test", "0", server.WithResourceCapabilities(false, true))
+	testutils.AssertNoError(t, New(store, nil).Publish(mcpServer, &server.Hooks{}))
+
+	resources := listResources(t, mcpServer)
+	testutils.AssertEqual(t, 1, len(resources))
+	testutils.AssertEqual(t, ResourceURI("existing"), resources[0].URI)
+
+	appendTurns(t, store, "created", "another question")
+	testutils.AssertEqual(t, 2, len(listResources(t, mcpServer)))
+
+	_, err := store.Delete("existing")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 1, len(listResources(t, mcpServer)))
+}
+
+func TestHandleRead(t *testing.T) {
+	store := newTestStore(t)
+	appendTurns(t, store, "conv", "what is this?")
+	s := New(store, nil)
+
+	request := mcp.ReadResourceRequest{}
+	request.Params.URI = ResourceURI("conv")
+	contents, err := s.HandleRead(context.Background(), request)
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 1, len(contents))
+	testutils.AssertContains(t, contents[0].(mcp.TextResourceContents).Text, "what is this?")
+
+	request.Params.URI = ResourceURI("missing")
+	_, err = s.HandleRead(context.Background(), request)
+	testutils.AssertError(t, err)
+}
+
+func TestResourcesFilteredByScope(t *testing.T) {
+	store := newTestStore(t)
+	turn := Turn{Prompt: "q", Response: "a"}
+	_, err := store.Append(Conversation{ID: "mine", Project: "/src/a"}, turn)
+	testutils.AssertNoError(t, err)
+	_, err = store.Append(Conversation{ID: "theirs", Project: "/src/b"}, turn)
+	testutils.AssertNoError(t, err)
+	s := New(store, func(context.Context, string) (Scope, error) { return Scope{Project: "/src/a"}, nil })
+
+	request := mcp.ReadResourceRequest{}
+	request.Params.URI = ResourceURI("mine")
+	_, err = s.HandleRead(context.Background(), request)
+	testutils.AssertNoError(t, err)
+	request.Params.URI = ResourceURI("theirs")
+	_, err = s.HandleRead(context.Background(), request)
+	testutils.AssertError(t, err)
+
+	listed := s.visibleResources(context.Background(), []mcp.Resource{
+		{URI: ResourceURI("mine")}, {URI: ResourceURI("theirs")}, {URI: "modagent://artifacts/x"},
+	})
+	testutils.AssertEqual(t, 2, len(listed))
+	testutils.AssertEqual(t, ResourceURI("mine"), listed[0].URI)
+	testutils.AssertEqual(t, "modagent://artifacts/x", listed[1].URI)
+}
+
+type testSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *testSession) Initialize()       {}
+func (s *testSession) Initialized() bool { return true }
+func (s *testSession) SessionID() string { return "s1" }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestPublishNotifiesListChanged(t *testing.T) {
+	store := newTestStore(t)
+	appendTurns(t, store, "conv", "question")
+
+	mcpServer := server.NewMCPServer("test", "0", server.WithResourceCapabilities(false, true))
+	testutils.AssertNoError(t, New(store, nil).Publish(mcpServer, &server.Hooks{}))
+	session := &testSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	testutils.AssertNoError(t, mcpServer.RegisterSession(context.Background(), session))
+
+	appendTurns(t, store, "conv", "follow-up")
+	close(session.notifications)
+	var methods []string
+	for notification := range session.notifications {
+		methods = append(methods, notification.Method)
+	}
+	testutils.AssertContains(t, strings.Join(methods, ","), mcp.MethodNotificationResourcesListChanged)
+	if slices.Contains(methods, mcp.MethodNotificationResourceUpdated) {
+		t.Fatalf("Expected no resources/updated without subscriptions, got %v", methods)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	store := newTestStore(t)
+	appendTurns(t, store, "conv", "question")
+
+	mcpServer := server.NewMCPServer("test", "0", server.WithResourceCapabilities(true, true))
+	cv := New(store, nil)
+	testutils.AssertNoError(t, cv.Publish(mcpServer, &server.Hooks{}))
+	session := &testSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	testutils.AssertNoError(t, mcpServer.RegisterSession(context.Background(), session))
+
+	updated := func() int {
+		count := 0
+		for {
+			select {
+			case notification := <-session.notifications:
+				if notification.Method == mcp.MethodNotificationResourceUpdated {
+					testutils.AssertEqual(t, ResourceURI("conv"), notification.Params.AdditionalFields["uri"])
+					count++
+				}
+			default:
+				return count
+			}
+		}
+	}
+
+	testutils.AssertError(t, cv.Subscribe("s1", ResourceURI("missing")))
+	testutils.AssertError(t, cv.Subscribe("s1", "file:///conv"))
+	testutils.AssertNoError(t, cv.Subscribe("s1", ResourceURI("conv")))
+	appendTurns(t, store, "conv", "follow-up")
+	testutils.AssertEqual(t, 1, updated())
+
+	cv.Unsubscribe("s1", ResourceURI("conv"))
+	appendTurns(t, store, "conv", "another")
+	testutils.AssertEqual(t, 0, updated())
+}
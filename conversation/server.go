@@ -0,0 +1,179 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultListLimit = 20
+
+// ScopeFunc resolves the scope of a call from its context and optional
+// working directory, rejecting directories the call may not access.
+type ScopeFunc func(ctx context.Context, cwd string) (Scope, error)
+
+type Server struct {
+	store *Store
+	scope ScopeFunc
+
+	mu sync.Mutex
+	// subscribers maps resource URIs to the IDs of subscribed sessions
+	subscribers map[string]map[string]bool
+}
+
+func New(store *Store, scope ScopeFunc) *Server {
+	return &Server{store: store, scope: scope, subscribers: make(map[string]map[string]bool)}
+}
+
+func (s *Server) HandleCall(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	action := request.GetString("action", "")
+	id := request.GetString("id", "")
+	if action != "list" && action != "import" && id == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("id is required for action %q", action)), nil
+	}
+	scope, err := s.resolveScope(ctx, request.GetString("cwd", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var result any
+	switch action {
+	case "list":
+		result, err = s.list(scope, request.GetInt("limit", defaultListLimit))
+	case "show":
+		result, err = s.show(scope, id)
+	case "fork":
+		result, err = s.fork(scope, id, request.GetInt("turn", 0), request.GetString("title", ""))
+	case "rename":
+		result, err = s.rename(scope, id, request.GetString("title", ""))
+	case "delete":
+		result, err = s.delete(scope, id)
+	case "export":
+		result, err = s.export(scope, id, request.GetString("format", FormatMarkdown))
+	case "import":
+		result, err = s.importConversation(scope, request.GetString("content", ""))
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("unknown action %q (valid: list, show, fork, rename, delete, export, import)", action)), nil
+	}
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	jsonBytes, _ := json.Marshal(result)
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// resolveScope returns the scope of a call; without a ScopeFunc every
+// conversation is visible.
+func (s *Server) resolveScope(ctx context.Context, cwd string) (Scope, error) {
+	if s.scope == nil {
+		return Scope{}, nil
+	}
+	return s.scope(ctx, cwd)
+}
+
+// get returns the conversation if it is visible in the scope.
+func (s *Server) get(scope Scope, id string) (*Conversation, error) {
+	c, err := s.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !scope.Contains(c) {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *Server) list(scope Scope, limit int) (any, error) {
+	conversations, err := s.store.List(scope, limit)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]Summary, 0, len(conversations))
+	for _, c := range conversations {
+		summaries = append(summaries, c.Summary())
+	}
+	return map[string]any{"conversations": summaries}, nil
+}
+
+func (s *Server) show(scope Scope, id string) (any, error) {
+	c, err := s.get(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"conversation": c.Summary(),
+		"transcript":   c.Transcript(),
+	}, nil
+}
+
+func (s *Server) fork(scope Scope, id string, turn int, title string) (any, error) {
+	c, err := s.store.Fork(scope, id, turn, title)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"conversation": c.Summary()}, nil
+}
+
+func (s *Server) rename(scope Scope, id, title string) (any, error) {
+	if title == "" {
+		return nil, fmt.Errorf("title is required for action \"rename\"")
+	}
+	if _, err := s.get(scope, id); err != nil {
+		return nil, err
+	}
+	c, err := s.store.Rename(id, title)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"conversation": c.Summary()}, nil
+}
+
+func (s *Server) delete(scope Scope, id string) (any, error) {
+	if _, err := s.get(scope, id); err != nil {
+		return nil, err
+	}
+	c, err := s.store.Delete(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.ModsID != "" {
+		// Best effort: the mods copy is only used for continuation
+		_ = exec.Command("mods", "--delete="+c.ModsID).Run()
+	}
+	return map[string]any{"deleted": c.ID}, nil
+}
+
+func (s *Server) export(scope Scope, id, format string) (any, error) {
+	c, err := s.get(scope, id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := c.Export(format)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"conversation": c.Summary(),
+		"format":       format,
+		"content":      string(content),
+	}, nil
+}
+
+func (s *Server) importConversation(scope Scope, content string) (any, error) {
+	if content == "" {
+		return nil, fmt.Errorf("content is required for action \"import\"")
+	}
+	c, err := Import([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+	if c, err = s.store.Import(scope, c); err != nil {
+		return nil, err
+	}
+	return map[string]any{"conversation": c.Summary()}, nil
+}
@@ -0,0 +1,75 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestHandleCall(t *testing.T) {
+	store := newTestStore(t)
+	appendTurns(t, store, "conv", "one", "two")
+	server := New(store, func(context.Context, string) (Scope, error) { return Scope{}, nil })
+
+	tests := []testutils.TableTest{
+		{Name: "list", Input: map[string]any{"action": "list"}, Expected: `"id":"conv"`},
+		{Name: "show", Input: map[string]any{"action": "show", "id": "conv"}, Expected: "## Turn 2"},
+		{Name: "fork", Input: map[string]any{"action": "fork", "id": "conv", "turn": float64(1)}, Expected: `"parent":"conv"`},
+		{Name: "rename", Input: map[string]any{"action": "rename", "id": "conv", "title": "renamed"}, Expected: `"title":"renamed"`},
+		{Name: "missing id", Input: map[string]any{"action": "show"}, WantErr: true},
+		{Name: "unknown id", Input: map[string]any{"action": "show", "id": "nope"}, WantErr: true},
+		{Name: "export", Input: map[string]any{"action": "export", "id": "conv", "format": "json"}, Expected: `"format":"json"`},
+		{Name: "import", Input: map[string]any{"action": "import", "content": "not an export"}, WantErr: true},
+		{Name: "unknown action", Input: map[string]any{"action": "merge", "id": "conv"}, WantErr: true},
+	}
+
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		result, err := server.HandleCall(context.Background(), testutils.CreateMCPRequest("conversations", tt.Input.(map[string]any)))
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, tt.WantErr, result.IsError)
+		if !tt.WantErr {
+			testutils.AssertContains(t, result.Content[0].(mcp.TextContent).Text, tt.Expected.(string))
+		}
+	})
+}
+
+func TestHandleCallHidesOtherScopes(t *testing.T) {
+	store := newTestStore(t)
+	turn := Turn{Prompt: "q", Response: "a"}
+	_, err := store.Append(Conversation{ID: "mine", Session: "s1", Project: "/src/a"}, turn)
+	testutils.AssertNoError(t, err)
+	_, err = store.Append(Conversation{ID: "theirs", Session: "s2", Project: "/src/a"}, turn)
+	testutils.AssertNoError(t, err)
+
+	server := New(store, func(context.Context, string) (Scope, error) { return Scope{Session: "s1", Project: "/src/a"}, nil })
+
+	result, err := server.HandleCall(context.Background(), testutils.CreateMCPRequest("conversations", map[string]any{"action": "list"}))
+	testutils.AssertNoError(t, err)
+	text := result.Content[0].(mcp.TextContent).Text
+	testutils.AssertContains(t, text, `"id":"mine"`)
+	if strings.Contains(text, "theirs") {
+		t.Fatalf("Expected other session's conversation to be hidden: %s", text)
+	}
+
+	for _, action := range []string{"show", "rename", "delete", "fork"} {
+		args := map[string]any{"action": action, "id": "theirs", "title": "x", "turn": float64(1)}
+		result, err := server.HandleCall(context.Background(), testutils.CreateMCPRequest("conversations", args))
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, true, result.IsError)
+	}
+}
+
+func TestHandleCallRejectsCwd(t *testing.T) {
+	server := New(newTestStore(t), func(context.Context, string) (Scope, error) {
+		return Scope{}, errors.New("cwd rejected")
+	})
+	args := map[string]any{"action": "list", "cwd": "/elsewhere"}
+	result, err := server.HandleCall(context.Background(), testutils.CreateMCPRequest("conversations", args))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, true, result.IsError)
+	testutils.AssertContains(t, result.Content[0].(mcp.TextContent).Text, "cwd rejected")
+}
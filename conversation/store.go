@@ -0,0 +1,374 @@
+package conversation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("conversation not found")
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+const maxTitleLength = 60
+
+// Turn is a single prompt/response exchange along with the context that was
+// attached to it.
+type Turn struct {
+	Time time.Time `json:"time"`
+	Role string    `json:"role,omitempty"`
+	// Prompt is the caller's request, Context the framed files and command
+	// output that were sent along with it.
+	Prompt   string   `json:"prompt"`
+	Context  string   `json:"context,omitempty"`
+	Response string   `json:"response"`
+	Files    []string `json:"files,omitempty"`
+	BashCmd  string   `json:"bash_cmd,omitempty"`
+}
+
+type Conversation struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Name is the human-friendly session name, unique within a scope.
+	Name    string `json:"name,omitempty"`
+	Session string `json:"session,omitempty"`
+	Project string `json:"project,omitempty"`
+	Tool    string `json:"tool,omitempty"`
+	// ModsID is set for conversations started by mods itself before the
+	// store existed; those are still continued through mods.
+	ModsID string `json:"mods_id,omitempty"`
+	// Compaction replaces the oldest turns with a summary when the history
+	// is replayed to the model.
+	Compaction *Compaction `json:"compaction,omitempty"`
+	Parent     string      `json:"parent,omitempty"`
+	ForkedAt   int         `json:"forked_at,omitempty"`
+	Created    time.Time   `json:"created"`
+	Updated    time.Time   `json:"updated"`
+	Turns      []Turn      `json:"turns"`
+}
+
+// Compaction is a summary of the first Turns turns of a conversation.
+type Compaction struct {
+	Summary string    `json:"summary"`
+	Turns   int       `json:"turns"`
+	Time    time.Time `json:"time"`
+}
+
+// Scope groups conversations by MCP client session and project directory.
+// An empty Session matches conversations of every session.
+type Scope struct {
+	Session string
+	Project string
+}
+
+// Contains reports whether the conversation is visible in the scope.
+// Conversations recorded without a session or project are visible anywhere.
+func (s Scope) Contains(c *Conversation) bool {
+	if c.Project != "" && c.Project != s.Project {
+		return false
+	}
+	return c.Session == "" || s.Session == "" || c.Session == s.Session
+}
+
+// ChangeKind tells observers what happened to a conversation.
+type ChangeKind int
+
+const (
+	Created ChangeKind = iota
+	Updated
+	Deleted
+)
+
+// Store keeps conversations as JSON files, one per conversation.
+type Store struct {
+	dir       string
+	mu        sync.Mutex
+	observers []func(ChangeKind, *Conversation)
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create conversation store: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// NewID returns a random conversation ID.
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// OnChange registers fn to be called after a conversation is created,
+// updated or deleted. It must be called before the store is shared.
+func (s *Store) OnChange(fn func(ChangeKind, *Conversation)) {
+	s.observers = append(s.observers, fn)
+}
+
+func (s *Store) notify(kind ChangeKind, c *Conversation, err error) {
+	if err != nil {
+		return
+	}
+	for _, fn := range s.observers {
+		fn(kind, c)
+	}
+}
+
+func (s *Store) path(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", fmt.Errorf("invalid conversation ID: %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *Store) Get(id string) (*Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(id)
+}
+
+func (s *Store) get(id string) (*Conversation, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("corrupt conversation %s: %w", id, err)
+	}
+	return &c, nil
+}
+
+func (s *Store) Save(c *Conversation) error {
+	s.mu.Lock()
+	_, err := s.get(c.ID)
+	kind := Updated
+	if err == ErrNotFound {
+		kind = Created
+	}
+	err = s.save(c)
+	s.mu.Unlock()
+
+	s.notify(kind, c, err)
+	return err
+}
+
+func (s *Store) save(c *Conversation) error {
+	path, err := s.path(c.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write atomically so readers never observe a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Append records a turn. If the conversation doesn't exist yet, it is
+// created from meta, which carries the ID, name, scope, tool and mods ID.
+func (s *Store) Append(meta Conversation, turn Turn) (*Conversation, error) {
+	s.mu.Lock()
+	c, kind, err := s.append(meta, turn)
+	s.mu.Unlock()
+
+	s.notify(kind, c, err)
+	return c, err
+}
+
+func (s *Store) append(meta Conversation, turn Turn) (*Conversation, ChangeKind, error) {
+	kind := Updated
+	c, err := s.get(meta.ID)
+	if err == ErrNotFound {
+		kind = Created
+		c = &Conversation{
+			ID:      meta.ID,
+			Title:   meta.Name,
+			Name:    meta.Name,
+			Session: meta.Session,
+			Project: meta.Project,
+			Tool:    meta.Tool,
+			Created: turn.Time,
+		}
+		if c.Title == "" {
+			c.Title = titleFromPrompt(turn.Prompt)
+		}
+	} else if err != nil {
+		return nil, kind, err
+	}
+	if meta.ModsID != "" {
+		c.ModsID = meta.ModsID
+	}
+	c.Turns = append(c.Turns, turn)
+	c.Updated = turn.Time
+	return c, kind, s.save(c)
+}
+
+// List returns conversations visible in the scope, most recently updated
+// first; limit <= 0 returns all of them.
+func (s *Store) List(scope Scope, limit int) ([]*Conversation, error) {
+	return s.list(scope.Contains, limit)
+}
+
+// ListAll returns conversations of every scope.
+func (s *Store) ListAll() ([]*Conversation, error) {
+	return s.list(func(*Conversation) bool { return true }, 0)
+}
+
+// FindByName returns the conversation with the session name in the scope.
+func (s *Store) FindByName(scope Scope, name string) (*Conversation, error) {
+	conversations, err := s.list(func(c *Conversation) bool {
+		return c.Name == name && scope.Contains(c)
+	}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(conversations) == 0 {
+		return nil, ErrNotFound
+	}
+	return conversations[0], nil
+}
+
+func (s *Store) list(match func(*Conversation) bool, limit int) ([]*Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var conversations []*Conversation
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		c, err := s.get(id)
+		if err != nil || !match(c) {
+			continue
+		}
+		conversations = append(conversations, c)
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].Updated.After(conversations[j].Updated)
+	})
+	if limit > 0 && len(conversations) > limit {
+		conversations = conversations[:limit]
+	}
+	return conversations, nil
+}
+
+func (s *Store) Rename(id, title string) (*Conversation, error) {
+	s.mu.Lock()
+	c, err := s.get(id)
+	if err == nil {
+		c.Title = title
+		err = s.save(c)
+	}
+	s.mu.Unlock()
+
+	s.notify(Updated, c, err)
+	return c, err
+}
+
+// SetCompaction stores the compaction of a conversation, leaving the rest
+// of it as it is now: turns appended while the summary was written are kept.
+func (s *Store) SetCompaction(id string, compaction *Compaction) (*Conversation, error) {
+	s.mu.Lock()
+	c, err := s.get(id)
+	if err == nil {
+		c.Compaction = compaction
+		err = s.save(c)
+	}
+	s.mu.Unlock()
+
+	s.notify(Updated, c, err)
+	return c, err
+}
+
+func (s *Store) Delete(id string) (*Conversation, error) {
+	s.mu.Lock()
+	c, err := s.get(id)
+	if err == nil {
+		path, _ := s.path(id)
+		err = os.Remove(path)
+	}
+	s.mu.Unlock()
+
+	s.notify(Deleted, c, err)
+	return c, err
+}
+
+// Fork copies the first turns of a conversation into a new one in the scope.
+func (s *Store) Fork(scope Scope, id string, turns int, title string) (*Conversation, error) {
+	s.mu.Lock()
+	fork, err := s.fork(scope, id, turns, title)
+	s.mu.Unlock()
+
+	s.notify(Created, fork, err)
+	return fork, err
+}
+
+func (s *Store) fork(scope Scope, id string, turns int, title string) (*Conversation, error) {
+	parent, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !scope.Contains(parent) {
+		return nil, ErrNotFound
+	}
+	if turns <= 0 || turns > len(parent.Turns) {
+		return nil, fmt.Errorf("turn must be between 1 and %d", len(parent.Turns))
+	}
+	if title == "" {
+		title = fmt.Sprintf("%s (fork at turn %d)", parent.Title, turns)
+	}
+	now := time.Now().UTC()
+	fork := &Conversation{
+		ID:       NewID(),
+		Title:    title,
+		Session:  scope.Session,
+		Project:  scope.Project,
+		Tool:     parent.Tool,
+		Parent:   parent.ID,
+		ForkedAt: turns,
+		Created:  now,
+		Updated:  now,
+		Turns:    append([]Turn{}, parent.Turns[:turns]...),
+	}
+	if parent.Compaction != nil && parent.Compaction.Turns <= turns {
+		compaction := *parent.Compaction
+		fork.Compaction = &compaction
+	}
+	return fork, s.save(fork)
+}
+
+func titleFromPrompt(prompt string) string {
+	title := strings.Join(strings.Fields(prompt), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength-1]) + "…"
+	}
+	return title
+}
@@ -0,0 +1,102 @@
+package conversation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anuramat/modagent/framing"
+)
+
+// Summary is the listing view of a conversation.
+type Summary struct {
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Name     string    `json:"name,omitempty"`
+	Tool     string    `json:"tool,omitempty"`
+	Turns    int       `json:"turns"`
+	Parent   string    `json:"parent,omitempty"`
+	ForkedAt int       `json:"forked_at,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+func (c *Conversation) Summary() Summary {
+	return Summary{
+		ID:       c.ID,
+		Title:    c.Title,
+		Name:     c.Name,
+		Tool:     c.Tool,
+		Turns:    len(c.Turns),
+		Parent:   c.Parent,
+		ForkedAt: c.ForkedAt,
+		Created:  c.Created,
+		Updated:  c.Updated,
+	}
+}
+
+// Transcript renders the conversation as Markdown for humans.
+func (c *Conversation) Transcript() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", c.Title)
+	if c.Parent != "" {
+		fmt.Fprintf(&b, "Forked from %s at turn %d.\n\n", c.Parent, c.ForkedAt)
+	}
+	if c.Compaction != nil {
+		fmt.Fprintf(&b, "Turns 1-%d were compacted for the model:\n\n%s\n\n", c.Compaction.Turns, c.Compaction.Summary)
+	}
+	for i, turn := range c.Turns {
+		fmt.Fprintf(&b, "## Turn %d (%s)\n\n", i+1, turn.Time.Format(time.RFC3339))
+		if turn.BashCmd != "" {
+			fmt.Fprintf(&b, "Command: `%s`\n\n", turn.BashCmd)
+		}
+		if len(turn.Files) > 0 {
+			fmt.Fprintf(&b, "Files: %s\n\n", strings.Join(turn.Files, ", "))
+		}
+		fmt.Fprintf(&b, "### Prompt\n\n%s\n\n### Response\n\n%s\n\n", turn.Prompt, turn.Response)
+	}
+	return b.String()
+}
+
+// History renders previous turns, including their context, for the model.
+func (c *Conversation) History() string {
+	return c.history(len(c.Turns))
+}
+
+// HistoryOmittingContext is like History, but keeps the injected context of
+// the last recent turns only.
+func (c *Conversation) HistoryOmittingContext(recent int) string {
+	return c.history(recent)
+}
+
+func (c *Conversation) history(withContext int) string {
+	// Prompts and replies are escaped, so a stored reply can't forge turns;
+	// the context was framed, and escaped, when it was first sent
+	var items []framing.Item
+	first := 0
+	if c.Compaction != nil {
+		first = min(c.Compaction.Turns, len(c.Turns))
+		items = append(items, framing.Item{
+			Kind:     "summary",
+			Attrs:    []framing.Attr{{Name: "turns", Value: strconv.Itoa(first)}},
+			Sections: []framing.Section{{Text: c.Compaction.Summary}},
+		})
+	}
+	for i, turn := range c.Turns[first:] {
+		user := framing.Item{Kind: "user"}
+		if turn.Context != "" {
+			if first+i >= len(c.Turns)-withContext {
+				user.Sections = append(user.Sections, framing.Section{Name: "context", Text: turn.Context, Framed: true})
+			} else {
+				user.Attrs = append(user.Attrs, framing.Attr{Name: "context", Value: "omitted"})
+			}
+		}
+		user.Sections = append(user.Sections, framing.Section{Name: "prompt", Text: turn.Prompt})
+		items = append(items, user, framing.Item{
+			Kind:     "assistant",
+			Sections: []framing.Section{{Text: turn.Response}},
+		})
+	}
+	return "<conversation_history>\n" + framing.Encode(framing.XML, items) + "</conversation_history>\n"
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anuramat/modagent/config"
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/core"
+)
+
+// runConversations implements the "modagent conversations" subcommand.
+func runConversations(cfg *config.Config, args []string, in io.Reader, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: modagent conversations export|import ...")
+	}
+	store, err := conversation.NewStore(cfg.GetConversationsDir())
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "export":
+		return exportConversation(store, args[1:], out)
+	case "import":
+		return importConversation(store, args[1:], in, out)
+	default:
+		return fmt.Errorf("unknown command %q (valid: export, import)", args[0])
+	}
+}
+
+func exportConversation(store *conversation.Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("conversations export", flag.ContinueOnError)
+	format := fs.String("format", conversation.FormatMarkdown, "Output format (markdown or json)")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: modagent conversations export [--format markdown|json] [-o file] ID")
+	}
+
+	c, err := store.Get(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	data, err := c.Export(*format)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, data, 0o600)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func importConversation(store *conversation.Store, args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("conversations import", flag.ContinueOnError)
+	project := fs.String("project", "", "Project directory to import into (default: the repository of the current directory)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: modagent conversations import [--project dir] FILE|-")
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(in)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	c, err := conversation.Import(data)
+	if err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(*project)
+	if err != nil {
+		return err
+	}
+	// No session: the conversation is picked up by whichever client works
+	// on the project next
+	c, err = store.Import(conversation.Scope{Project: core.ProjectDir(dir)}, c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, c.ID)
+	return nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+const mediaTypePDF = "application/pdf"
+
+// attachmentTypes are the media types sent to the model as attachments
+// rather than as text.
+var attachmentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	mediaTypePDF: true,
+}
+
+// AttachmentsPolicy describes what the model backend can take besides text.
+type AttachmentsPolicy struct {
+	// Multimodal backends get images and PDFs as attachments; text-only
+	// ones get the text of PDFs and no images.
+	Multimodal bool
+	// Flag is the mods flag used to attach a file. Stock mods has none, so
+	// there is no default; multimodal backends need it set.
+	Flag string
+}
+
+// attachmentType returns the media type of content if it is an image or a
+// PDF, and "" otherwise.
+func attachmentType(content []byte) string {
+	mediaType := http.DetectContentType(content)
+	if attachmentTypes[mediaType] {
+		return mediaType
+	}
+	return ""
+}
+
+// prepareAttachment turns an image or PDF into something the backend can
+// take: multimodal backends get the file itself, text-only backends the text
+// of PDFs, and images are rejected.
+func (s *BaseServer) prepareAttachment(ctx context.Context, file *contextFile, mediaType string) error {
+	if s.options.Attachments.Multimodal {
+		if s.options.Attachments.Flag == "" {
+			return fmt.Errorf("%s is an attachment (%s), but attachments.flag isn't set; set it to the flag your mods build attaches files with", file.Path, mediaType)
+		}
+		file.MediaType = mediaType
+		return nil
+	}
+	if mediaType != mediaTypePDF {
+		return fmt.Errorf("%s is an image (%s), but the configured backend can't handle images; set attachments.multimodal for a multimodal backend", file.Path, mediaType)
+	}
+	text, err := extractPDFText(ctx, file.Path)
+	if err != nil {
+		return err
+	}
+	file.Content = []byte(text)
+	file.ExtractedFrom = mediaType
+	return nil
+}
+
+// extractPDFText converts a PDF to text with pdftotext from poppler.
+func extractPDFText(ctx context.Context, path string) (string, error) {
+	cmd := exec.CommandContext(ctx, "pdftotext", "-layout", "-enc", "UTF-8", path, "-")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to extract text from %s: %v, stderr: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// attachArgs returns the mods flags attaching files.
+func (s *BaseServer) attachArgs(paths []string) []string {
+	var args []string
+	for _, path := range paths {
+		args = append(args, s.options.Attachments.Flag, path)
+	}
+	return args
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	pdfHeader = "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"
+)
+
+// fakeTool puts an executable script named name first on PATH.
+func fakeTool(t *testing.T, name, script string) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-bin-*")
+	testutils.AssertNoError(t, err)
+	t.Cleanup(cleanup)
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755))
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+}
+
+func TestAttachmentType(t *testing.T) {
+	tests := []testutils.TableTest{
+		{Name: "png", Input: pngHeader, Expected: "image/png"},
+		{Name: "jpeg", Input: "\xff\xd8\xff\xe0\x00\x10JFIF", Expected: "image/jpeg"},
+		{Name: "webp", Input: "RIFF\x00\x00\x00\x00WEBPVP8 ", Expected: "image/webp"},
+		{Name: "pdf", Input: pdfHeader, Expected: "application/pdf"},
+		{Name: "gif is not supported", Input: "GIF89a", Expected: ""},
+		{Name: "text", Input: "package main\n", Expected: ""},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		testutils.AssertEqual(t, tt.Expected, attachmentType([]byte(tt.Input.(string))))
+	})
+}
+
+func TestCollectFilesAttachments(t *testing.T) {
+	root, cleanup, err := testutils.CreateTempDir("modagent-test-attachments-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	writeTree(t, root, map[string]string{
+		"shot.png":  pngHeader,
+		"spec.pdf":  pdfHeader,
+		"notes.txt": "notes\n",
+	})
+	fakeTool(t, "pdftotext", "echo \"text of $4\"\n")
+	ctx := context.Background()
+
+	t.Run("multimodal", func(t *testing.T) {
+		s := NewBaseServer(&testutils.MockConfig{}, Options{Attachments: AttachmentsPolicy{Multimodal: true, Flag: "--image"}})
+		files, manifest, err := s.collectFiles(ctx, []string{"shot.png", "spec.pdf"}, root)
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, "shot.png,spec.pdf", manifestPaths(manifest.Included, root))
+		testutils.AssertEqual(t, "image/png", files[0].MediaType)
+		testutils.AssertEqual(t, "application/pdf", files[1].MediaType)
+	})
+
+	t.Run("text only", func(t *testing.T) {
+		s := NewBaseServer(&testutils.MockConfig{}, Options{})
+		_, _, err := s.collectFiles(ctx, []string{"shot.png"}, root)
+		testutils.AssertError(t, err)
+		testutils.AssertContains(t, err.Error(), "can't handle images")
+
+		files, manifest, err := s.collectFiles(ctx, []string{root}, root)
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, "notes.txt,spec.pdf", manifestPaths(manifest.Included, root))
+		testutils.AssertEqual(t, "shot.png:unsupported_media", manifestPaths(manifest.Excluded, root))
+		testutils.AssertEqual(t, "text of "+filepath.Join(root, "spec.pdf")+"\n", string(files[1].Content))
+		testutils.AssertEqual(t, "", files[1].MediaType)
+		testutils.AssertEqual(t, "application/pdf", files[1].ExtractedFrom)
+	})
+
+	t.Run("multimodal without flag", func(t *testing.T) {
+		s := NewBaseServer(&testutils.MockConfig{}, Options{Attachments: AttachmentsPolicy{Multimodal: true}})
+		_, _, err := s.collectFiles(ctx, []string{"shot.png"}, root)
+		testutils.AssertError(t, err)
+		testutils.AssertContains(t, err.Error(), "attachments.flag")
+	})
+
+	t.Run("selectors", func(t *testing.T) {
+		s := NewBaseServer(&testutils.MockConfig{}, Options{Attachments: AttachmentsPolicy{Multimodal: true, Flag: "--image"}})
+		_, _, err := s.collectFiles(ctx, []string{"spec.pdf:1-2"}, root)
+		testutils.AssertError(t, err)
+	})
+}
+
+func TestAttachmentsPassedToMods(t *testing.T) {
+	root, cleanup, err := testutils.CreateTempDir("modagent-test-attachments-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	writeTree(t, root, map[string]string{"shot.png": pngHeader})
+	// The fake mods prints its arguments and what it got on stdin
+	fakeTool(t, "mods", "echo \"$@\"\ncat\n")
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Attachments: AttachmentsPolicy{Multimodal: true, Flag: "--image"}})
+	request := testutils.CreateMCPRequest("junior-r", map[string]any{
+		"prompt":    "what is wrong here?",
+		"filepaths": []any{"shot.png"},
+		"cwd":       root,
+	})
+	result, err := s.HandleCallReadonly(context.Background(), request)
+	testutils.AssertNoError(t, err)
+	response := testutils.ParseJSONResponse(t, result.Content[0].(mcp.TextContent).Text)["response"].(string)
+
+	path := filepath.Join(root, "shot.png")
+	testutils.AssertContains(t, response, "--image "+path+"  what is wrong here?")
+	testutils.AssertContains(t, response, `<attachment path="`+path+`" media_type="image/png"></attachment>`)
+	if strings.Contains(response, "PNG") {
+		t.Fatalf("Image content leaked into stdin: %q", response)
+	}
+}
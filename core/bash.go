@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/audit"
+	"github.com/anuramat/modagent/conversation"
+)
+
+// Statuses of commands that didn't run to completion.
+const (
+	bashSkipped = "skipped"
+	bashStopped = "stopped"
+)
+
+// bashResult is the outcome of one command of a call.
+type bashResult struct {
+	Command        string
+	Stdout, Stderr bytes.Buffer
+	ExitStatus     int
+	// Status is bashSkipped or bashStopped for commands that didn't run to
+	// completion because an earlier one failed.
+	Status string
+}
+
+// bashCommands returns the commands of a call: bash_cmd followed by
+// bash_cmds.
+func (a CallArgs) bashCommands() []string {
+	var commands []string
+	if a.BashCmd != "" {
+		commands = append(commands, a.BashCmd)
+	}
+	return append(commands, a.BashCmds...)
+}
+
+// runBash runs the commands of a call, one after another or in parallel,
+// feeding each the same stdin. With BashStopOnFailure, the first failure
+// skips the commands that haven't started and stops the ones that are
+// running.
+func (s *BaseServer) runBash(ctx context.Context, a CallArgs, stdin string) []*bashResult {
+	commands := a.bashCommands()
+	results := make([]*bashResult, len(commands))
+	for i, command := range commands {
+		results[i] = &bashResult{Command: command}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	progress := ProgressFromContext(ctx)
+	run := func(r *bashResult) {
+		progress.Report("running bash_cmd: " + r.Command)
+		cmd := s.options.Exec.BashCommand(runCtx, r.Command, a.Cwd, a.Env)
+		cmd.Stdin = strings.NewReader(stdin)
+		cmd.Stdout = &r.Stdout
+		cmd.Stderr = &r.Stderr
+		if err := cmd.Run(); err != nil {
+			if exitError, ok := err.(*exec.ExitError); ok {
+				r.ExitStatus = exitError.ExitCode()
+			} else {
+				r.ExitStatus = 1
+			}
+		}
+		progress.Report(fmt.Sprintf("bash_cmd exited with status %d: %s", r.ExitStatus, r.Command))
+		if r.ExitStatus == 0 || !a.BashStopOnFailure {
+			return
+		}
+		stopping := false
+		once.Do(func() {
+			stopping = true
+			cancel()
+		})
+		if !stopping && runCtx.Err() != nil {
+			r.Status = bashStopped
+		}
+	}
+
+	if !a.BashParallel {
+		for _, r := range results {
+			if runCtx.Err() != nil {
+				r.Status = bashSkipped
+				continue
+			}
+			run(r)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	for _, r := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(r)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// artifactStore returns the store for command output, which defaults to the
+// user's cache directory.
+func (s *BaseServer) artifactStore() *artifacts.Store {
+	if s.options.Artifacts == nil {
+		return artifacts.NewStore(artifacts.DefaultRoot())
+	}
+	return s.options.Artifacts
+}
+
+// bashContext runs the commands of a call and saves their output to an
+// artifact directory: stdout and stderr for a single command, or a numbered
+// directory per command with the command itself as well.
+func (s *BaseServer) bashContext(ctx context.Context, a CallArgs, scope conversation.Scope, report *contextReport) ([]contextItem, error) {
+	stdin, err := s.ReadBashStdin(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	results := s.runBash(ctx, a, stdin)
+
+	commands := make([]string, len(results))
+	exitStatus := 0
+	for i, r := range results {
+		commands[i] = r.Command
+		if exitStatus == 0 && r.Status == "" {
+			exitStatus = r.ExitStatus
+		}
+	}
+	audit.FromContext(ctx).SetExec(strings.Join(commands, "\n"), exitStatus)
+
+	tempDir, err := s.artifactStore().Create(scopeKey(scope))
+	if err != nil {
+		return nil, err
+	}
+	report.TempDir = tempDir
+
+	hasStdin := a.BashStdin != "" || a.BashStdinPath != ""
+	if hasStdin {
+		if err := os.WriteFile(filepath.Join(tempDir, "stdin"), []byte(stdin), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write stdin file: %v", err)
+		}
+	}
+
+	var items []contextItem
+	for i, r := range results {
+		dir := tempDir
+		if len(results) > 1 {
+			dir = filepath.Join(tempDir, strconv.Itoa(i+1))
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				return nil, fmt.Errorf("failed to create temp directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "command"), []byte(r.Command), 0o600); err != nil {
+				return nil, fmt.Errorf("failed to write command file: %v", err)
+			}
+		}
+		if r.Status != bashSkipped {
+			if err := os.WriteFile(filepath.Join(dir, "stdout"), r.Stdout.Bytes(), 0o600); err != nil {
+				return nil, fmt.Errorf("failed to write stdout file: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "stderr"), r.Stderr.Bytes(), 0o600); err != nil {
+				return nil, fmt.Errorf("failed to write stderr file: %v", err)
+			}
+		}
+
+		item := contextItem{Kind: "bash", Attrs: []attr{{Name: "command", Value: r.Command}}}
+		if r.Status != "" {
+			item.Attrs = append(item.Attrs, attr{Name: "status", Value: r.Status})
+		} else {
+			item.Attrs = append(item.Attrs, attr{Name: "exit_status", Value: strconv.Itoa(r.ExitStatus)})
+		}
+		if r.Status == bashSkipped {
+			items = append(items, item)
+			continue
+		}
+		// The input is the same for every command, so only the first
+		// one shows it
+		if i == 0 && a.BashStdinPath != "" {
+			item.Attrs = append(item.Attrs, attr{Name: "stdin_path", Value: a.BashStdinPath})
+		}
+		if i == 0 && hasStdin {
+			item.Sections = append(item.Sections, section{Name: "stdin", Text: s.redact(stdin, report)})
+		}
+		item.Sections = append(item.Sections,
+			section{Name: "stdout", Text: s.redact(r.Stdout.String(), report), KeepTail: true},
+			section{Name: "stderr", Text: s.redact(r.Stderr.String(), report), KeepTail: true},
+		)
+		items = append(items, item)
+	}
+
+	if report.Artifacts, err = s.artifactStore().Announce(ctx, tempDir); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
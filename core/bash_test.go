@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/testutils"
+)
+
+func TestRunBash(t *testing.T) {
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+	commands := []string{"echo one", "false", "echo three"}
+
+	summary := func(results []*bashResult) string {
+		var parts []string
+		for _, r := range results {
+			status := r.Status
+			if status == "" {
+				status = strings.TrimSpace(r.Stdout.String()) + ":" + strconv.Itoa(r.ExitStatus)
+			}
+			parts = append(parts, status)
+		}
+		return strings.Join(parts, ",")
+	}
+	tests := []testutils.TableTest{
+		{Name: "sequential", Input: CallArgs{BashCmds: commands}, Expected: "one:0,:1,three:0"},
+		{Name: "sequential stop on failure", Input: CallArgs{BashCmds: commands, BashStopOnFailure: true}, Expected: "one:0,:1,skipped"},
+		{Name: "parallel", Input: CallArgs{BashCmds: commands, BashParallel: true}, Expected: "one:0,:1,three:0"},
+		{Name: "bash_cmd runs first", Input: CallArgs{BashCmd: "echo zero", BashCmds: commands[:1]}, Expected: "zero:0,one:0"},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		testutils.AssertEqual(t, tt.Expected, summary(s.runBash(context.Background(), tt.Input.(CallArgs), "")))
+	})
+
+	t.Run("parallel stop on failure", func(t *testing.T) {
+		a := CallArgs{BashCmds: []string{"sleep 0.1; exit 3", "sleep 10"}, BashParallel: true, BashStopOnFailure: true}
+		results := s.runBash(context.Background(), a, "")
+		testutils.AssertEqual(t, 3, results[0].ExitStatus)
+		testutils.AssertEqual(t, "", results[0].Status)
+		testutils.AssertEqual(t, bashStopped, results[1].Status)
+	})
+}
+
+func TestBashContext(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-bash-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Artifacts: artifacts.NewStore(dir)})
+	a := CallArgs{BashCmds: []string{"cat", "false", "echo never"}, BashStdin: "in\n", BashStopOnFailure: true}
+	var report contextReport
+	items, err := s.bashContext(context.Background(), a, conversation.Scope{}, &report)
+	testutils.AssertNoError(t, err)
+
+	encoded := encodeItems(ContextFormatXML, items)
+	testutils.AssertContains(t, encoded, `<bash command="cat" exit_status="0"><stdin>in
+</stdin><stdout>in
+</stdout><stderr></stderr></bash>`)
+	testutils.AssertContains(t, encoded, `<bash command="false" exit_status="1"><stdout></stdout><stderr></stderr></bash>`)
+	testutils.AssertContains(t, encoded, `<bash command="echo never" status="skipped"></bash>`)
+
+	stdout, err := os.ReadFile(filepath.Join(report.TempDir, "1", "stdout"))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "in\n", string(stdout))
+	command, err := os.ReadFile(filepath.Join(report.TempDir, "2", "command"))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "false", string(command))
+	_, err = os.Stat(filepath.Join(report.TempDir, "3", "stdout"))
+	testutils.AssertError(t, err)
+
+	testutils.AssertEqual(t, 8, len(report.Artifacts))
+	testutils.AssertEqual(t, "1/stdout", report.Artifacts[2].Name)
+	testutils.AssertEqual(t, artifacts.ResourceURIPrefix, strings.TrimSuffix(report.Artifacts[2].URI, filepath.Base(filepath.Dir(report.TempDir))+"/"+filepath.Base(report.TempDir)+"/1/stdout"))
+}
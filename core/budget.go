@@ -0,0 +1,182 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// minItemTokens is the smallest useful share of the budget; items that
+// would get less are dropped rather than truncated to a stub.
+const minItemTokens = 32
+
+const truncationMarker = "\n[... %d of %d characters trimmed to fit the context budget ...]\n"
+
+const (
+	trimmedTruncated = "truncated"
+	trimmedDropped   = "dropped"
+)
+
+// Estimator approximates token counts from text length for a model
+// backend. Exact counts would need each backend's tokenizer, which mods
+// doesn't expose.
+type Estimator struct {
+	Backend       string
+	CharsPerToken float64
+}
+
+var DefaultEstimator = Estimator{Backend: "default", CharsPerToken: 4}
+
+var charsPerToken = map[string]float64{
+	"default":   4,
+	"openai":    4,
+	"google":    4,
+	"anthropic": 3.5,
+	"ollama":    3.3,
+}
+
+// NewEstimator returns the estimator for a backend: default, openai,
+// google, anthropic or ollama.
+func NewEstimator(backend string) (Estimator, error) {
+	ratio, ok := charsPerToken[backend]
+	if !ok {
+		names := make([]string, 0, len(charsPerToken))
+		for name := range charsPerToken {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Estimator{}, fmt.Errorf("unknown estimator backend %q (valid: %s)", backend, strings.Join(names, ", "))
+	}
+	return Estimator{Backend: backend, CharsPerToken: ratio}, nil
+}
+
+func (e Estimator) Estimate(text string) int {
+	if e.CharsPerToken <= 0 {
+		e = DefaultEstimator
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / e.CharsPerToken))
+}
+
+// Budget limits the size of the prompt and context of a call.
+type Budget struct {
+	// MaxTokens of 0 disables the budget.
+	MaxTokens int
+	Estimator Estimator
+}
+
+func (s *BaseServer) budgetFor(tool string) Budget {
+	return s.options.Budgets[tool]
+}
+
+// budgetReport lists everything that was cut to fit the budget.
+type budgetReport struct {
+	MaxTokens  int           `json:"max_tokens"`
+	UsedTokens int           `json:"used_tokens"`
+	Estimator  string        `json:"estimator"`
+	Trimmed    []trimmedItem `json:"trimmed"`
+}
+
+type trimmedItem struct {
+	Item           string `json:"item"`
+	Section        string `json:"section,omitempty"`
+	Action         string `json:"action"`
+	OriginalTokens int    `json:"original_tokens"`
+	KeptTokens     int    `json:"kept_tokens"`
+}
+
+// fit trims items, which are in priority order, so that they fit the budget
+// along with the prompt. Each item takes what it needs from what's left;
+// the first one that doesn't fit is truncated and later ones get whatever
+// remains, or are dropped when that's too little to be useful. The report
+// is nil when nothing was trimmed.
+func (b Budget) fit(items []contextItem, prompt, format string) ([]contextItem, *budgetReport) {
+	if b.MaxTokens <= 0 {
+		return items, nil
+	}
+	estimate := b.Estimator.Estimate
+	remaining := b.MaxTokens - estimate(prompt)
+
+	var kept []contextItem
+	var trimmed []trimmedItem
+	for _, item := range items {
+		framing := item
+		framing.Sections = make([]section, len(item.Sections))
+		sizes := make([]int, len(item.Sections))
+		total := 0
+		for i, sec := range item.Sections {
+			framing.Sections[i] = section{Name: sec.Name}
+			sizes[i] = estimate(sec.Text)
+			total += sizes[i]
+		}
+		overhead := estimate(encodeItems(format, []contextItem{framing}))
+
+		if overhead+total <= remaining {
+			kept = append(kept, item)
+			remaining -= overhead + total
+			continue
+		}
+		available := remaining - overhead
+		if available < minItemTokens {
+			trimmed = append(trimmed, trimmedItem{Item: item.Label(), Action: trimmedDropped, OriginalTokens: total})
+			continue
+		}
+
+		// Small sections are kept whole where possible, so that e.g. a
+		// short stderr survives next to a huge stdout
+		order := make([]int, len(sizes))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return sizes[order[i]] < sizes[order[j]] })
+		item.Sections = append([]section(nil), item.Sections...)
+		for n, i := range order {
+			share := available / (len(order) - n)
+			if sizes[i] <= share {
+				available -= sizes[i]
+				continue
+			}
+			sec := &item.Sections[i]
+			sec.Text = b.truncate(sec.Text, share, sec.KeepTail)
+			keptTokens := estimate(sec.Text)
+			available -= keptTokens
+			trimmed = append(trimmed, trimmedItem{
+				Item:           item.Label(),
+				Section:        sec.Name,
+				Action:         trimmedTruncated,
+				OriginalTokens: sizes[i],
+				KeptTokens:     keptTokens,
+			})
+		}
+		kept = append(kept, item)
+		remaining = available
+	}
+
+	if len(trimmed) == 0 {
+		return kept, nil
+	}
+	return kept, &budgetReport{
+		MaxTokens:  b.MaxTokens,
+		UsedTokens: b.MaxTokens - remaining,
+		Estimator:  b.Estimator.Backend,
+		Trimmed:    trimmed,
+	}
+}
+
+// truncate cuts text down to about tokens, marking where it was cut.
+func (b Budget) truncate(text string, tokens int, keepTail bool) string {
+	runes := []rune(text)
+	// The marker can only get shorter once the trimmed count is known
+	longest := utf8.RuneCountInString(fmt.Sprintf(truncationMarker, len(runes), len(runes)))
+	ratio := b.Estimator.CharsPerToken
+	if ratio <= 0 {
+		ratio = DefaultEstimator.CharsPerToken
+	}
+	keep := min(len(runes), max(0, int(float64(tokens)*ratio)-longest))
+	marker := fmt.Sprintf(truncationMarker, len(runes)-keep, len(runes))
+	if keepTail {
+		return marker + string(runes[len(runes)-keep:])
+	}
+	return string(runes[:keep]) + marker
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+func TestNewEstimator(t *testing.T) {
+	e, err := NewEstimator("anthropic")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 2, e.Estimate("1234567"))
+	testutils.AssertEqual(t, 1, DefaultEstimator.Estimate("ключ"))
+
+	_, err = NewEstimator("gpt-17")
+	testutils.AssertError(t, err)
+}
+
+func TestBudgetFit(t *testing.T) {
+	bash := contextItem{
+		Kind:  "bash",
+		Attrs: []attr{{Name: "command", Value: "go test ./..."}, {Name: "exit_status", Value: "1"}},
+		Sections: []section{
+			{Name: "stdout", Text: strings.Repeat("ok\n", 2000) + "FAIL: TestBudget\n", KeepTail: true},
+			{Name: "stderr", Text: "exit status 1\n", KeepTail: true},
+		},
+	}
+	file := func(path string, size int) contextItem {
+		return contextItem{
+			Kind:     "file",
+			Attrs:    []attr{{Name: "path", Value: path}},
+			Sections: []section{{Text: "package main\n" + strings.Repeat("x", size)}},
+		}
+	}
+	budget := Budget{MaxTokens: 1000, Estimator: DefaultEstimator}
+
+	// Everything fits
+	items, report := budget.fit([]contextItem{file("/a.go", 100)}, "prompt", ContextFormatXML)
+	testutils.AssertEqual(t, 1, len(items))
+	if report != nil {
+		t.Fatalf("Expected no report, got %+v", report)
+	}
+
+	// Command output keeps its end and the short stderr; files are
+	// truncated from the end, then dropped
+	items, report = budget.fit([]contextItem{bash, file("/a.go", 100), file("/b.go", 100)}, "prompt", ContextFormatXML)
+	testutils.AssertEqual(t, 1, len(items))
+	stdout, stderr := items[0].Sections[0].Text, items[0].Sections[1].Text
+	testutils.AssertContains(t, stdout, "characters trimmed to fit the context budget")
+	if !strings.HasSuffix(stdout, "FAIL: TestBudget\n") {
+		t.Fatalf("Expected the end of stdout to be kept: %q", stdout[len(stdout)-40:])
+	}
+	testutils.AssertEqual(t, "exit status 1\n", stderr)
+
+	testutils.AssertEqual(t, 3, len(report.Trimmed))
+	testutils.AssertEqual(t, trimmedItem{Item: "bash go test ./...", Section: "stdout", Action: trimmedTruncated, OriginalTokens: 1505, KeptTokens: report.Trimmed[0].KeptTokens}, report.Trimmed[0])
+	testutils.AssertEqual(t, trimmedItem{Item: "file /a.go", Action: trimmedDropped, OriginalTokens: 29}, report.Trimmed[1])
+	testutils.AssertEqual(t, "file /b.go", report.Trimmed[2].Item)
+	if report.UsedTokens > budget.MaxTokens {
+		t.Fatalf("Expected the context to fit the budget, used %d", report.UsedTokens)
+	}
+
+	// A file that partly fits keeps its beginning
+	items, report = budget.fit([]contextItem{file("/big.go", 8000)}, "prompt", ContextFormatXML)
+	testutils.AssertEqual(t, 1, len(items))
+	if !strings.HasPrefix(items[0].Sections[0].Text, "package main\n") {
+		t.Fatal("Expected the start of the file to be kept")
+	}
+	testutils.AssertEqual(t, trimmedTruncated, report.Trimmed[0].Action)
+}
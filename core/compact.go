@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anuramat/modagent/conversation"
+)
+
+const compactionPrompt = "Summarise the conversation above for your own future reference. " +
+	"Keep decisions, conclusions, open questions, file names, identifiers and facts stated by the user; " +
+	"drop anything that was superseded. Reply with the summary only."
+
+// CompactionPolicy configures compaction of replayed conversation histories.
+type CompactionPolicy struct {
+	Enabled bool
+	// MaxTokens is the budget for the history and the new context combined.
+	MaxTokens int
+	// Threshold is the fraction of MaxTokens at which compaction starts.
+	Threshold float64
+	// KeepTurns is the number of recent turns that are always replayed in
+	// full.
+	KeepTurns int
+	// Role is the mods role used for summaries; empty uses the read-only
+	// default role, so that summarising never runs tools with write access.
+	Role string
+}
+
+// EstimateTokens approximates the token count of text with the default
+// estimator.
+func EstimateTokens(text string) int {
+	return DefaultEstimator.Estimate(text)
+}
+
+// compactionReport tells the caller how the history was shrunk.
+type compactionReport struct {
+	TokensBefore int `json:"tokens_before"`
+	TokensAfter  int `json:"tokens_after"`
+	// ContextOmitted counts older turns whose files and command output were
+	// left out of the history.
+	ContextOmitted int `json:"context_omitted_turns,omitempty"`
+	// Summarised counts turns replaced by a summary.
+	Summarised int `json:"summarised_turns,omitempty"`
+}
+
+// compactHistory returns the history to replay for the conversation. When
+// it doesn't fit the budget along with reserved tokens of new input, the
+// injected context of older turns is dropped first; if that's not enough,
+// older turns are summarised by the model and the summary is stored with
+// the conversation so later calls reuse it.
+func (s *BaseServer) compactHistory(ctx context.Context, c *conversation.Conversation, cwd string, reserved int) (string, *compactionReport) {
+	policy := s.options.Compaction
+	history := c.History()
+	if !policy.Enabled || policy.MaxTokens <= 0 {
+		return history, nil
+	}
+	budget := int(float64(policy.MaxTokens)*policy.Threshold) - reserved
+	before := EstimateTokens(history)
+	if before <= budget {
+		return history, nil
+	}
+
+	report := &compactionReport{TokensBefore: before}
+	recent := min(policy.KeepTurns, len(c.Turns))
+	// Files and command output are the bulk of most histories
+	history = c.HistoryOmittingContext(recent)
+	report.ContextOmitted = omittedContexts(c, recent)
+
+	first := 0
+	if c.Compaction != nil {
+		first = c.Compaction.Turns
+	}
+	if upTo := len(c.Turns) - recent; EstimateTokens(history) > budget && upTo > first {
+		ProgressFromContext(ctx).Report(fmt.Sprintf("compacting conversation history (%d turns)", upTo))
+		role := policy.Role
+		if role == "" {
+			role = s.config.GetDefaultRole(true)
+		}
+		summary, err := s.summarise(ctx, c, upTo, role, cwd)
+		if err != nil {
+			// A failed summary leaves the history with its context omitted,
+			// which is still smaller than the original
+			fmt.Fprintf(os.Stderr, "Failed to compact conversation %s: %v\n", c.ID, err)
+		} else {
+			c.Compaction = &conversation.Compaction{Summary: summary, Turns: upTo, Time: time.Now().UTC()}
+			if _, err := s.options.Conversations.SetCompaction(c.ID, c.Compaction); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to save compacted conversation %s: %v\n", c.ID, err)
+			}
+			history = c.HistoryOmittingContext(recent)
+			report.Summarised = upTo
+			report.ContextOmitted = omittedContexts(c, recent)
+		}
+	}
+	report.TokensAfter = EstimateTokens(history)
+	return history, report
+}
+
+// summarise asks the model for a summary of the first turns of c.
+func (s *BaseServer) summarise(ctx context.Context, c *conversation.Conversation, turns int, role, cwd string) (string, error) {
+	partial := *c
+	partial.Turns = c.Turns[:turns]
+
+	cmd := buildModsCmd(ctx, CallArgs{Prompt: " " + compactionPrompt, Role: role, Cwd: cwd}, s.config.GetDefaultRole)
+	cmd.Stdin = strings.NewReader(partial.HistoryOmittingContext(0))
+	stdout, stderr, err := runCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("%v, stderr: %s", err, stderr)
+	}
+	summary := strings.TrimSpace(stdout)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// omittedContexts counts replayed turns whose context is left out when only
+// the last recent turns keep theirs.
+func omittedContexts(c *conversation.Conversation, recent int) int {
+	first := 0
+	if c.Compaction != nil {
+		first = c.Compaction.Turns
+	}
+	n := 0
+	for i := first; i < len(c.Turns)-recent; i++ {
+		if c.Turns[i].Context != "" {
+			n++
+		}
+	}
+	return n
+}
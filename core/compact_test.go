@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/testutils"
+)
+
+// fakeMods puts a mods stub that prints output on PATH.
+func fakeMods(t *testing.T, output string) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-mods-*")
+	testutils.AssertNoError(t, err)
+	t.Cleanup(cleanup)
+	script := "#!/bin/sh\ncat >/dev/null\necho '" + output + "'\n"
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(dir, "mods"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+}
+
+func TestCompactHistory(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-conversations-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	store, err := conversation.NewStore(dir)
+	testutils.AssertNoError(t, err)
+
+	bigContext := strings.Repeat("x", 4000)
+	c := &conversation.Conversation{ID: "conv"}
+	for _, prompt := range []string{"one", "two", "three"} {
+		c.Turns = append(c.Turns, conversation.Turn{Prompt: prompt, Context: bigContext, Response: "re: " + prompt})
+	}
+	testutils.AssertNoError(t, store.Save(c))
+
+	policy := CompactionPolicy{Enabled: true, MaxTokens: 1500, Threshold: 1, KeepTurns: 1}
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Conversations: store, Compaction: policy})
+
+	// Dropping the context of older turns is enough
+	history, report := s.compactHistory(context.Background(), c, "", 0)
+	testutils.AssertEqual(t, 2, report.ContextOmitted)
+	testutils.AssertEqual(t, 0, report.Summarised)
+	testutils.AssertEqual(t, 1, strings.Count(history, bigContext))
+
+	// Not enough room: older turns are summarised and the summary is stored
+	fakeMods(t, "the gist")
+	history, report = s.compactHistory(context.Background(), c, "", 500)
+	testutils.AssertEqual(t, 2, report.Summarised)
+	testutils.AssertContains(t, history, "the gist")
+	if report.TokensAfter >= report.TokensBefore {
+		t.Fatalf("Expected history to shrink: %+v", report)
+	}
+	stored, err := store.Get("conv")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 2, stored.Compaction.Turns)
+
+	// Small histories are left alone
+	s.options.Compaction.MaxTokens = 1 << 20
+	history, report = s.compactHistory(context.Background(), stored, "", 0)
+	if report != nil {
+		t.Fatalf("Expected no compaction, got %+v", report)
+	}
+	testutils.AssertEqual(t, stored.History(), history)
+}
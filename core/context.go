@@ -0,0 +1,35 @@
+package core
+
+import "github.com/anuramat/modagent/framing"
+
+// Context formats: how items are framed for the model.
+const (
+	ContextFormatXML      = framing.XML
+	ContextFormatMarkdown = framing.Markdown
+	ContextFormatJSON     = framing.JSON
+)
+
+// Context items are framed by the framing package; kinds used here are
+// bash, git_diff, git_log, git_blame, file, attachment, question and answer
+// for junior-panel aggregation, and reply for JSON repairs.
+type (
+	contextItem = framing.Item
+	attr        = framing.Attr
+	section     = framing.Section
+)
+
+// ValidateContextFormat returns an error for unknown context formats.
+func ValidateContextFormat(format string) error {
+	return framing.Validate(format)
+}
+
+func (s *BaseServer) contextFormat(tool string) string {
+	if format, ok := s.options.ContextFormats[tool]; ok {
+		return format
+	}
+	return ContextFormatXML
+}
+
+func encodeItems(format string, items []contextItem) string {
+	return framing.Encode(format, items)
+}
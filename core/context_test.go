@@ -0,0 +1,12 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+func TestValidateContextFormat(t *testing.T) {
+	testutils.AssertNoError(t, ValidateContextFormat(ContextFormatMarkdown))
+	testutils.AssertError(t, ValidateContextFormat("yaml"))
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anuramat/modagent/conversation"
+)
+
+// conversationState describes how a call continues an earlier conversation.
+type conversationState struct {
+	// ID is the conversation ID reported back to the caller.
+	ID string
+	// Name is the session name of a new conversation.
+	Name  string
+	Scope conversation.Scope
+	// ModsID is passed to mods --continue for conversations that predate the
+	// store; empty means mods runs without any conversation cache.
+	ModsID string
+	// History replays the stored turns to the model.
+	History string
+	// Stored is the conversation whose history is replayed.
+	Stored *conversation.Conversation
+}
+
+// resolveConversation looks up the caller's conversation, given either by ID
+// or by session name, in the store. Unknown IDs are assumed to be legacy mods
+// conversations and passed through; conversations of other scopes are not
+// found. A new conversation gets a fresh ID.
+func (s *BaseServer) resolveConversation(scope conversation.Scope, id, name string) (conversationState, error) {
+	if id != "" && name != "" {
+		return conversationState{}, fmt.Errorf("conversation and session are mutually exclusive")
+	}
+	if s.options.Conversations == nil {
+		return conversationState{ID: id, ModsID: id}, nil
+	}
+
+	var c *conversation.Conversation
+	var err error
+	switch {
+	case name != "":
+		c, err = s.options.Conversations.FindByName(scope, name)
+		if err == conversation.ErrNotFound {
+			return conversationState{ID: conversation.NewID(), Name: name, Scope: scope}, nil
+		}
+	case id != "":
+		c, err = s.options.Conversations.Get(id)
+		if err == conversation.ErrNotFound {
+			return conversationState{ID: id, Scope: scope, ModsID: id}, nil
+		}
+		if err == nil && !scope.Contains(c) {
+			return conversationState{}, fmt.Errorf("conversation %s not found in this session", id)
+		}
+	default:
+		return conversationState{ID: conversation.NewID(), Scope: scope}, nil
+	}
+	if err != nil {
+		return conversationState{}, err
+	}
+
+	state := conversationState{ID: c.ID, Scope: scope, ModsID: c.ModsID}
+	if c.ModsID == "" {
+		state.History = c.History()
+		state.Stored = c
+	}
+	return state, nil
+}
+
+// recordTurn stores the exchange, including the injected context, and
+// returns the conversation ID to report.
+func (s *BaseServer) recordTurn(tool string, state conversationState, a CallArgs, role, context, response string) string {
+	if state.ID == "" || s.options.Conversations == nil {
+		return state.ID
+	}
+	meta := conversation.Conversation{
+		ID:      state.ID,
+		Name:    state.Name,
+		Session: state.Scope.Session,
+		Project: state.Scope.Project,
+		Tool:    tool,
+		ModsID:  state.ModsID,
+	}
+	turn := conversation.Turn{
+		Time:     time.Now().UTC(),
+		Role:     role,
+		Prompt:   strings.TrimSpace(a.Prompt),
+		Context:  context,
+		Response: response,
+		Files:    a.Filepaths,
+		BashCmd:  strings.Join(a.bashCommands(), "\n"),
+	}
+	if _, err := s.options.Conversations.Append(meta, turn); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to record conversation %s: %v\n", state.ID, err)
+	}
+	return state.ID
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/testutils"
+)
+
+func TestResolveConversation(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-conversations-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	store, err := conversation.NewStore(dir)
+	testutils.AssertNoError(t, err)
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Conversations: store})
+	scope := conversation.Scope{Session: "client-1", Project: "/src/a"}
+
+	// New conversations get a modagent ID and no mods conversation
+	state, err := s.resolveConversation(scope, "", "")
+	testutils.AssertNoError(t, err)
+	if state.ID == "" {
+		t.Fatal("Expected a new conversation ID")
+	}
+	testutils.AssertEqual(t, "", state.ModsID)
+
+	id := s.recordTurn("junior-r", state, CallArgs{Prompt: " q", BashCmd: "ls"}, "junior-r", "<bash/>", "a")
+	testutils.AssertEqual(t, state.ID, id)
+
+	state, err = s.resolveConversation(scope, id, "")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "", state.ModsID)
+	testutils.AssertContains(t, state.History, "<context><bash/></context><prompt>q</prompt></user>")
+	testutils.AssertContains(t, state.History, "<assistant>\na</assistant>")
+
+	// Conversations of other clients and projects are not visible
+	_, err = s.resolveConversation(conversation.Scope{Session: "client-2", Project: "/src/a"}, id, "")
+	testutils.AssertError(t, err)
+	_, err = s.resolveConversation(conversation.Scope{Session: "client-1", Project: "/src/b"}, id, "")
+	testutils.AssertError(t, err)
+
+	// Unknown IDs are legacy mods conversations
+	state, err = s.resolveConversation(scope, "legacy123", "")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "legacy123", state.ModsID)
+	testutils.AssertEqual(t, "", state.History)
+	s.recordTurn("junior-r", state, CallArgs{Prompt: " q"}, "junior-r", "", "a")
+
+	c, err := store.Get("legacy123")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "legacy123", c.ModsID)
+
+	fork, err := store.Fork(scope, "legacy123", 1, "")
+	testutils.AssertNoError(t, err)
+	state, err = s.resolveConversation(scope, fork.ID, "")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "", state.ModsID)
+	testutils.AssertContains(t, state.History, "q")
+}
+
+func TestResolveNamedSession(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-conversations-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	store, err := conversation.NewStore(dir)
+	testutils.AssertNoError(t, err)
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Conversations: store})
+	scope := conversation.Scope{Session: "client-1", Project: "/src/a"}
+
+	_, err = s.resolveConversation(scope, "abc", "auth-refactor")
+	testutils.AssertError(t, err)
+
+	first, err := s.resolveConversation(scope, "", "auth-refactor")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "", first.History)
+	s.recordTurn("junior-r", first, CallArgs{Prompt: "q"}, "junior-r", "", "a")
+
+	// The same name continues the conversation within the scope only
+	again, err := s.resolveConversation(scope, "", "auth-refactor")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, first.ID, again.ID)
+	testutils.AssertContains(t, again.History, "q")
+
+	other, err := s.resolveConversation(conversation.Scope{Session: "client-1", Project: "/src/b"}, "", "auth-refactor")
+	testutils.AssertNoError(t, err)
+	if other.ID == first.ID {
+		t.Fatal("Expected a separate conversation in another project")
+	}
+}
+
+func TestBuildModsCmdCaching(t *testing.T) {
+	getRole := func(bool) string { return "junior-r" }
+
+	cmd := buildModsCmd(context.Background(), CallArgs{Prompt: " q"}, getRole)
+	testutils.AssertContains(t, cmd.String(), "--no-cache")
+
+	cmd = buildModsCmd(context.Background(), CallArgs{Prompt: " q", Conversation: "legacy"}, getRole)
+	testutils.AssertContains(t, cmd.String(), "--continue=legacy")
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultEnvDeny lists environment variable patterns that are dropped from
+// bash_cmd environments unless explicitly allowed.
+var DefaultEnvDeny = []string{
+	"*_TOKEN",
+	"*_SECRET",
+	"*_SECRET_KEY",
+	"*_PASSWORD",
+	"*_API_KEY",
+	"*_ACCESS_KEY",
+	"*_ACCESS_KEY_ID",
+	"*_PRIVATE_KEY",
+	"*_CREDENTIALS",
+}
+
+// ExecPolicy controls where and with which environment bash commands run.
+type ExecPolicy struct {
+	// AllowedRoots restricts the cwd parameter; empty means any directory.
+	AllowedRoots []string
+	// EnvDeny holds glob patterns of variable names to drop.
+	EnvDeny []string
+	// EnvAllow holds glob patterns that pass through even if denied.
+	EnvAllow []string
+	// MaxStdin caps the size of bash_stdin in bytes; 0 means no limit.
+	MaxStdin int64
+}
+
+// ResolveCwd validates a requested working directory against the policy.
+// An empty cwd resolves to an empty string, i.e. the server's own cwd.
+func (p ExecPolicy) ResolveCwd(cwd string) (string, error) {
+	if cwd == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(cwd) {
+		return "", fmt.Errorf("cwd must be an absolute path: %s", cwd)
+	}
+	info, err := os.Stat(cwd)
+	if err != nil {
+		return "", fmt.Errorf("invalid cwd %s: %v", cwd, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cwd is not a directory: %s", cwd)
+	}
+	cwd = filepath.Clean(cwd)
+	if len(p.AllowedRoots) == 0 {
+		return cwd, nil
+	}
+	for _, root := range p.AllowedRoots {
+		if isWithinResolved(cwd, root) {
+			return cwd, nil
+		}
+	}
+	return "", fmt.Errorf("cwd %s is outside of allowed roots %v", cwd, p.AllowedRoots)
+}
+
+// BuildEnv scrubs the base environment according to the policy and appends
+// the caller-supplied variables, which always take precedence.
+func (p ExecPolicy) BuildEnv(base []string, extra map[string]string) []string {
+	env := make([]string, 0, len(base)+len(extra))
+	for _, kv := range base {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, overridden := extra[name]; overridden {
+			continue
+		}
+		if p.denied(name) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	for name, value := range extra {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+func (p ExecPolicy) denied(name string) bool {
+	if matchAny(p.EnvAllow, name) {
+		return false
+	}
+	return matchAny(p.EnvDeny, name)
+}
+
+// BashCommand builds a bash invocation that honours the policy.
+func (p ExecPolicy) BashCommand(ctx context.Context, command, cwd string, env map[string]string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Dir = cwd
+	cmd.Env = p.BuildEnv(os.Environ(), env)
+	return cmd
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithinResolved is isWithin after resolving symlinks in both paths, so a
+// link inside root that points elsewhere doesn't count as inside.
+func isWithinResolved(target, root string) bool {
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return false
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	return isWithin(resolved, realRoot)
+}
+
+func isWithin(target, root string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), target)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/testutils"
+)
+
+func TestResolveCwd(t *testing.T) {
+	root, cleanup, err := testutils.CreateTempDir("modagent-test-cwd-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+
+	inside := filepath.Join(root, "repo")
+	testutils.AssertNoError(t, os.MkdirAll(inside, 0o755))
+	file := filepath.Join(root, "file")
+	testutils.AssertNoError(t, os.WriteFile(file, nil, 0o644))
+	outside, cleanupOutside, err := testutils.CreateTempDir("modagent-test-outside-*")
+	testutils.AssertNoError(t, err)
+	defer cleanupOutside()
+	escape := filepath.Join(root, "escape")
+	testutils.AssertNoError(t, os.Symlink(outside, escape))
+
+	policy := ExecPolicy{AllowedRoots: []string{root}}
+
+	tests := []testutils.TableTest{
+		{Name: "empty", Input: "", Expected: ""},
+		{Name: "root itself", Input: root, Expected: root},
+		{Name: "inside root", Input: inside + "/", Expected: inside},
+		{Name: "relative", Input: "repo", WantErr: true},
+		{Name: "outside root", Input: os.TempDir(), WantErr: true},
+		{Name: "escape via dotdot", Input: inside + "/../..", WantErr: true},
+		{Name: "not a directory", Input: file, WantErr: true},
+		{Name: "escape via symlink", Input: escape, WantErr: true},
+		{Name: "missing", Input: filepath.Join(root, "missing"), WantErr: true},
+	}
+
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		result, err := policy.ResolveCwd(tt.Input.(string))
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+			return
+		}
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, tt.Expected, result)
+	})
+}
+
+func TestBuildEnv(t *testing.T) {
+	policy := ExecPolicy{
+		EnvDeny:  DefaultEnvDeny,
+		EnvAllow: []string{"GOPROXY_TOKEN"},
+	}
+	base := []string{
+		"PATH=/bin",
+		"GITHUB_TOKEN=secret",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"OPENAI_API_KEY=secret",
+		"GOPROXY_TOKEN=kept",
+		"HOME=/home/user",
+	}
+
+	env := policy.BuildEnv(base, map[string]string{"HOME": "/tmp", "FOO": "bar"})
+	joined := strings.Join(env, "\n")
+
+	for _, want := range []string{"PATH=/bin", "GOPROXY_TOKEN=kept", "HOME=/tmp", "FOO=bar"} {
+		testutils.AssertContains(t, joined, want)
+	}
+	for _, unwanted := range []string{"GITHUB_TOKEN", "OPENAI_API_KEY", "HOME=/home/user"} {
+		if strings.Contains(joined, unwanted) {
+			t.Fatalf("Expected %q to be scrubbed from %q", unwanted, joined)
+		}
+	}
+}
+
+func TestBashCommandUsesCwdAndEnv(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-bash-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+
+	cmd := ExecPolicy{}.BashCommand(context.Background(), `printf "%s %s" "$PWD" "$FOO"`, dir, map[string]string{"FOO": "bar"})
+	output, err := cmd.Output()
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, dir+" bar", string(output))
+}
+
+func TestBashStdin(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-bash-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	writeTree(t, dir, map[string]string{"input.txt": "pear\napple\n"})
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Exec: ExecPolicy{MaxStdin: 16}, Artifacts: artifacts.NewStore(dir)})
+	tests := []testutils.TableTest{
+		{Name: "text", Input: CallArgs{BashStdin: "b\na\n"}, Expected: "<stdin>b\na\n</stdin><stdout>a\nb\n</stdout>"},
+		{Name: "relative file", Input: CallArgs{BashStdinPath: "input.txt"}, Expected: "<stdin>pear\napple\n</stdin><stdout>apple\npear\n</stdout>"},
+		{Name: "no stdin", Input: CallArgs{}, Expected: "<stdout></stdout>"},
+		{Name: "text over the limit", Input: CallArgs{BashStdin: strings.Repeat("x\n", 9)}, WantErr: true},
+		{Name: "missing file", Input: CallArgs{BashStdinPath: "nope.txt"}, WantErr: true},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		a := tt.Input.(CallArgs)
+		a.BashCmd = "sort"
+		a.Cwd = dir
+		stdin, _, err := s.prepareStdin(context.Background(), "junior-r", a, conversation.Scope{})
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+			return
+		}
+		testutils.AssertNoError(t, err)
+		testutils.AssertContains(t, stdin.String(), tt.Expected.(string))
+	})
+}
@@ -0,0 +1,327 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// binarySniffLength is how much of a file is checked for NUL bytes, the same
+// heuristic git uses to tell binary files apart.
+const binarySniffLength = 8000
+
+// Reasons for leaving a file out of the context.
+const (
+	excludedBinary           = "binary"
+	excludedMaxFiles         = "max_files"
+	excludedMaxTotalSize     = "max_total_size"
+	excludedOutsideRoots     = "outside_roots"
+	excludedUnreadable       = "unreadable"
+	excludedUnsupportedMedia = "unsupported_media"
+)
+
+// FilesPolicy limits how much file content a single call may attach.
+type FilesPolicy struct {
+	// MaxFiles caps the number of files; 0 means no limit.
+	MaxFiles int
+	// MaxTotalSize caps the combined size of the files in bytes; 0 means no
+	// limit.
+	MaxTotalSize int64
+}
+
+// contextFile is a file selected for the context.
+type contextFile struct {
+	Path    string
+	Content []byte
+	// Start and End are the original line numbers of a selection.
+	Start, End int
+	Symbol     string
+	// MediaType is set for images and PDFs that are attached as files
+	// rather than included as text.
+	MediaType string
+	// ExtractedFrom is the media type the text was extracted from, if any.
+	ExtractedFrom string
+}
+
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Lines  string `json:"lines,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// fileManifest lists what was included in the context and what was left out.
+type fileManifest struct {
+	Included []manifestEntry `json:"included"`
+	Excluded []manifestEntry `json:"excluded,omitempty"`
+}
+
+// collectFiles expands the filepaths entries, which may be files, parts of
+// files (see parseSelection), directories or glob patterns with "**", into
+// the files to attach. Images and PDFs are prepared for the backend, see
+// prepareAttachment.
+// Relative entries are resolved against cwd. Directory and glob expansion
+// skips files ignored by git as well as binary files, and stops at the
+// limits of the files policy; explicitly listed files must exist and be
+// within the client roots.
+func (s *BaseServer) collectFiles(ctx context.Context, entries []string, cwd string) ([]contextFile, *fileManifest, error) {
+	var files []contextFile
+	manifest := &fileManifest{Included: []manifestEntry{}}
+	seen := make(map[string]bool)
+	var total int64
+
+	add := func(path string, sel *selection, explicit bool) error {
+		key := path
+		if sel != nil {
+			key += sel.String()
+		}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+
+		if err := s.options.Roots.Check(ctx, path); err != nil {
+			if explicit {
+				return fmt.Errorf("file rejected: %v", err)
+			}
+			manifest.Excluded = append(manifest.Excluded, manifestEntry{Path: path, Reason: excludedOutsideRoots})
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err == nil && !info.Mode().IsRegular() {
+			err = fmt.Errorf("not a regular file")
+		}
+		if err != nil {
+			if explicit {
+				return fmt.Errorf("failed to read file %s: %v", path, err)
+			}
+			manifest.Excluded = append(manifest.Excluded, manifestEntry{Path: path, Reason: excludedUnreadable})
+			return nil
+		}
+
+		// Limits are checked before reading whole files, so that a huge
+		// directory costs no more than its listing
+		entry := manifestEntry{Path: path, Bytes: info.Size()}
+		file := contextFile{Path: path}
+		loaded := false
+		if sel != nil {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read file %s: %v", path, err)
+			}
+			if attachmentType(content) != "" {
+				return fmt.Errorf("line and symbol selectors don't apply to images and PDFs: %s", path)
+			}
+			if file.Content, file.Start, file.End, err = sel.apply(path, content); err != nil {
+				return err
+			}
+			file.Symbol = sel.Symbol
+			entry.Lines = fmt.Sprintf("%d-%d", file.Start, file.End)
+			entry.Bytes = int64(len(file.Content))
+			loaded = true
+		}
+		policy := s.options.Files
+		switch {
+		case policy.MaxFiles > 0 && len(files) >= policy.MaxFiles:
+			entry.Reason = excludedMaxFiles
+		case policy.MaxTotalSize > 0 && total+entry.Bytes > policy.MaxTotalSize:
+			entry.Reason = excludedMaxTotalSize
+		case !loaded:
+			if file.Content, err = os.ReadFile(path); err != nil {
+				if explicit {
+					return fmt.Errorf("failed to read file %s: %v", path, err)
+				}
+				entry.Reason = excludedUnreadable
+				break
+			}
+			fallthrough
+		default:
+			if mediaType := attachmentType(file.Content); mediaType != "" {
+				if err := s.prepareAttachment(ctx, &file, mediaType); err != nil {
+					if explicit {
+						return err
+					}
+					entry.Reason = excludedUnsupportedMedia
+				}
+			} else if isBinary(file.Content) {
+				entry.Reason = excludedBinary
+			}
+		}
+		if entry.Reason != "" {
+			manifest.Excluded = append(manifest.Excluded, entry)
+			return nil
+		}
+		entry.Bytes = int64(len(file.Content))
+		total += entry.Bytes
+		files = append(files, file)
+		manifest.Included = append(manifest.Included, entry)
+		return nil
+	}
+
+	for _, entry := range entries {
+		entry, sel, err := parseSelection(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !filepath.IsAbs(entry) {
+			base := cwd
+			if base == "" {
+				base, _ = os.Getwd()
+			}
+			entry = filepath.Join(base, entry)
+		}
+
+		var paths []string
+		switch info, statErr := os.Stat(entry); {
+		case sel != nil:
+			err = add(entry, sel, true)
+		case hasGlobMeta(entry) && os.IsNotExist(statErr):
+			// Existing paths like app/[id].tsx are taken literally
+			paths, err = s.expandGlob(ctx, entry)
+		case statErr == nil && info.IsDir():
+			paths, err = s.expandDir(ctx, entry)
+		default:
+			err = add(entry, nil, true)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range paths {
+			if err := add(p, nil, false); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return files, manifest, nil
+}
+
+func (s *BaseServer) expandDir(ctx context.Context, dir string) ([]string, error) {
+	if err := s.options.Roots.Check(ctx, dir); err != nil {
+		return nil, fmt.Errorf("directory rejected: %v", err)
+	}
+	return listFiles(ctx, dir, nil, s.listLimit())
+}
+
+// listLimit bounds listings: one file past MaxFiles is enough to report
+// that the limit was hit, and large trees such as / aren't walked whole.
+func (s *BaseServer) listLimit() int {
+	if s.options.Files.MaxFiles <= 0 {
+		return 0
+	}
+	return s.options.Files.MaxFiles + 1
+}
+
+// expandGlob matches pattern against the files below its longest directory
+// prefix without glob characters.
+func (s *BaseServer) expandGlob(ctx context.Context, pattern string) ([]string, error) {
+	base := filepath.Dir(pattern)
+	for hasGlobMeta(base) {
+		base = filepath.Dir(base)
+	}
+	if err := s.options.Roots.Check(ctx, base); err != nil {
+		return nil, fmt.Errorf("glob rejected: %v", err)
+	}
+	rel, err := filepath.Rel(base, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(filepath.ToSlash(rel), ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %s: %v", pattern, err)
+	}
+
+	patternParts := strings.Split(filepath.ToSlash(rel), "/")
+	return listFiles(ctx, base, func(file string) bool {
+		name, _ := filepath.Rel(base, file)
+		return matchSegments(patternParts, strings.Split(filepath.ToSlash(name), "/"))
+	}, s.listLimit())
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// matches any number of segments.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchSegments(pattern[1:], name[1:])
+}
+
+// listFiles returns the files below dir that match, sorted, up to limit
+// files unless it's 0; match may be nil. Inside a git work tree it asks git,
+// so that ignored files are skipped; elsewhere it walks the tree, skipping
+// .git directories, and stops at the limit.
+func listFiles(ctx context.Context, dir string, match func(string) bool, limit int) ([]string, error) {
+	matches := func(file string) bool {
+		return match == nil || match(file)
+	}
+	cmd := exec.CommandContext(ctx, "git", "ls-files", "--cached", "--others", "--exclude-standard", "-z")
+	cmd.Dir = dir
+	if output, err := cmd.Output(); err == nil {
+		var files []string
+		for _, name := range strings.Split(string(output), "\x00") {
+			if name == "" {
+				continue
+			}
+			file := filepath.Join(dir, name)
+			if !matches(file) {
+				continue
+			}
+			// ls-files also lists deleted files that are still in the index
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				files = append(files, file)
+			}
+		}
+		sort.Strings(files)
+		if limit > 0 && len(files) > limit {
+			files = files[:limit]
+		}
+		return files, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() && matches(p) {
+			files = append(files, p)
+			if limit > 0 && len(files) >= limit {
+				return fs.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", dir, err)
+	}
+	return files, nil
+}
+
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binarySniffLength)], 0) >= 0
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		testutils.AssertNoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		testutils.AssertNoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func manifestPaths(entries []manifestEntry, root string) string {
+	var names []string
+	for _, entry := range entries {
+		name, _ := filepath.Rel(root, entry.Path)
+		if entry.Reason != "" {
+			name += ":" + entry.Reason
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCollectFiles(t *testing.T) {
+	root, cleanup, err := testutils.CreateTempDir("modagent-test-files-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	writeTree(t, root, map[string]string{
+		".gitignore":        "build/\n",
+		"main.go":           "package main\n",
+		"src/a.go":          "package src\n",
+		"src/deep/b.go":     "package deep\n",
+		"src/deep/notes.md": "notes\n",
+		"src/logo.png":      "\x89PNG\x00\x00",
+		"build/out.go":      "package out\n",
+		"app/[id].tsx":      "export {}\n",
+	})
+	if err := exec.Command("git", "-C", root, "init", "-q").Run(); err != nil {
+		t.Skip("git is not available")
+	}
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+	tests := []testutils.TableTest{
+		{Name: "explicit file", Input: []string{filepath.Join(root, "main.go")}, Expected: "main.go"},
+		{Name: "relative file", Input: []string{"main.go"}, Expected: "main.go"},
+		{Name: "directory skips ignored and binary files", Input: []string{"src"}, Expected: "src/a.go,src/deep/b.go,src/deep/notes.md|src/logo.png:binary"},
+		{Name: "recursive glob", Input: []string{"src/**/*.go"}, Expected: "src/a.go,src/deep/b.go"},
+		{Name: "single level glob", Input: []string{"src/*.go"}, Expected: "src/a.go"},
+		{Name: "duplicates", Input: []string{"src/a.go", "src/*.go"}, Expected: "src/a.go"},
+		{Name: "literal path with glob characters", Input: []string{"app/[id].tsx"}, Expected: "app/[id].tsx"},
+		{Name: "explicit ignored file", Input: []string{"build/out.go"}, Expected: "build/out.go"},
+		{Name: "missing file", Input: []string{"nope.go"}, WantErr: true},
+		{Name: "invalid glob", Input: []string{"src/[.go"}, WantErr: true},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		files, manifest, err := s.collectFiles(context.Background(), tt.Input.([]string), root)
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+			return
+		}
+		testutils.AssertNoError(t, err)
+		got := manifestPaths(manifest.Included, root)
+		if len(manifest.Excluded) > 0 {
+			got += "|" + manifestPaths(manifest.Excluded, root)
+		}
+		testutils.AssertEqual(t, tt.Expected, got)
+		testutils.AssertEqual(t, len(manifest.Included), len(files))
+	})
+}
+
+func TestCollectFilesLimits(t *testing.T) {
+	root, cleanup, err := testutils.CreateTempDir("modagent-test-files-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	writeTree(t, root, map[string]string{"a": "1234", "b": "1234", "c": "12345678"})
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Files: FilesPolicy{MaxFiles: 2}})
+	_, manifest, err := s.collectFiles(context.Background(), []string{root}, "")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "a,b|c:max_files", manifestPaths(manifest.Included, root)+"|"+manifestPaths(manifest.Excluded, root))
+
+	s = NewBaseServer(&testutils.MockConfig{}, Options{Files: FilesPolicy{MaxTotalSize: 10}})
+	_, manifest, err = s.collectFiles(context.Background(), []string{root}, "")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "a,b|c:max_total_size", manifestPaths(manifest.Included, root)+"|"+manifestPaths(manifest.Excluded, root))
+
+	// Listings stop one file past the limit
+	s = NewBaseServer(&testutils.MockConfig{}, Options{Files: FilesPolicy{MaxFiles: 2}})
+	writeTree(t, root, map[string]string{"d": "1", "e": "1"})
+	_, manifest, err = s.collectFiles(context.Background(), []string{filepath.Join(root, "*")}, "")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, "a,b|c:max_files", manifestPaths(manifest.Included, root)+"|"+manifestPaths(manifest.Excluded, root))
+}
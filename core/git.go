@@ -0,0 +1,179 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Special git_diff values; anything else is a ref to diff the working tree
+// against.
+const (
+	GitDiffWorktree = "worktree"
+	GitDiffStaged   = "staged"
+)
+
+// gitContext gathers the git_diff, git_log and git_blame context of a call
+// by running git in cwd, so that callers don't have to compose shell
+// commands for the common review workflows.
+func (s *BaseServer) gitContext(ctx context.Context, a CallArgs, report *contextReport) ([]contextItem, error) {
+	if a.GitDiff == "" && a.GitLog == 0 && len(a.GitBlame) == 0 {
+		return nil, nil
+	}
+	ProgressFromContext(ctx).Report("collecting git context")
+	dir, err := s.gitDir(ctx, a.Cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []contextItem
+
+	if a.GitDiff != "" {
+		args := []string{"diff", "--no-ext-diff", "--no-textconv"}
+		switch a.GitDiff {
+		case GitDiffWorktree:
+		case GitDiffStaged:
+			args = append(args, "--cached")
+		default:
+			if strings.HasPrefix(a.GitDiff, "-") {
+				return nil, fmt.Errorf("invalid git_diff ref: %s", a.GitDiff)
+			}
+			args = append(args, a.GitDiff)
+		}
+		diff, err := s.runGit(ctx, dir, a.Env, append(args, "--")...)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, contextItem{
+			Kind:     "git_diff",
+			Attrs:    []attr{{Name: "against", Value: a.GitDiff}},
+			Sections: []section{{Text: s.redact(diff, report)}},
+		})
+	}
+
+	if a.GitLog > 0 {
+		log, err := s.runGit(ctx, dir, a.Env, "log", "--patch", "--no-ext-diff", "--no-textconv", "-n", strconv.Itoa(a.GitLog), "--")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, contextItem{
+			Kind:     "git_log",
+			Attrs:    []attr{{Name: "count", Value: strconv.Itoa(a.GitLog)}},
+			Sections: []section{{Text: s.redact(log, report)}},
+		})
+	}
+
+	for _, entry := range a.GitBlame {
+		path, sel, err := parseSelection(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if err := s.options.Roots.Check(ctx, path); err != nil {
+			return nil, fmt.Errorf("git_blame rejected: %v", err)
+		}
+
+		args := []string{"blame", "--no-textconv"}
+		attrs := []attr{{Name: "path", Value: path}}
+		if sel != nil {
+			start, end := sel.Start, sel.End
+			if sel.Symbol != "" {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read file %s: %v", path, err)
+				}
+				if start, end, err = findGoSymbol(path, content, sel.Symbol); err != nil {
+					return nil, err
+				}
+			}
+			attrs = append(attrs, attr{Name: "lines", Value: fmt.Sprintf("%d-%d", start, end)})
+			args = append(args, "-L", fmt.Sprintf("%d,%d", start, end))
+		}
+		blame, err := s.runGit(ctx, dir, a.Env, append(args, "--", path)...)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, contextItem{
+			Kind:     "git_blame",
+			Attrs:    attrs,
+			Sections: []section{{Text: s.redact(blame, report)}},
+		})
+	}
+
+	return items, nil
+}
+
+// gitDir returns the directory git runs in: cwd, or the server's working
+// directory, checked against the allowed roots either way.
+func (s *BaseServer) gitDir(ctx context.Context, cwd string) (string, error) {
+	if cwd == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get working directory: %v", err)
+		}
+		cwd = dir
+	}
+	return s.ResolveCwd(ctx, cwd)
+}
+
+// runGit runs git in dir. The repository's config and .gitattributes could
+// otherwise run arbitrary commands, so external diff drivers and textconv
+// filters are disabled by the callers' flags, and the fsmonitor hook and
+// clean/smudge filters are overridden here.
+func (s *BaseServer) runGit(ctx context.Context, dir string, env map[string]string, args ...string) (string, error) {
+	overrides, err := s.gitOverrides(ctx, dir, env)
+	if err != nil {
+		return "", err
+	}
+	return s.git(ctx, dir, env, append(overrides, args...)...)
+}
+
+// gitOverrides returns the -c options disabling config that runs commands.
+func (s *BaseServer) gitOverrides(ctx context.Context, dir string, env map[string]string) ([]string, error) {
+	overrides := []string{"-c", "core.fsmonitor=false"}
+	// Reading config runs nothing; exit status 1 means no filters are set
+	filters, err := s.git(ctx, dir, env, "config", "-z", "--get-regexp", `^filter\.`)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(filters, "\x00") {
+		key, _, _ := strings.Cut(entry, "\n")
+		i := strings.LastIndex(key, ".")
+		if i <= len("filter.") || seen[key[:i]] {
+			continue
+		}
+		driver := key[:i]
+		seen[driver] = true
+		for _, option := range []string{"clean=", "smudge=", "process=", "required=false"} {
+			overrides = append(overrides, "-c", driver+"."+option)
+		}
+	}
+	return overrides, nil
+}
+
+func (s *BaseServer) git(ctx context.Context, dir string, env map[string]string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--no-pager"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = s.options.Exec.BuildEnv(os.Environ(), env)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		command := args[0]
+		for i := 0; i+2 < len(args) && args[i] == "-c"; i += 2 {
+			command = args[i+2]
+		}
+		return "", fmt.Errorf("git %s failed: %w, stderr: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
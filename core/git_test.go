@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+func setupGitRepo(t *testing.T) string {
+	root, cleanup, err := testutils.CreateTempDir("modagent-test-git-*")
+	testutils.AssertNoError(t, err)
+	t.Cleanup(cleanup)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = root
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git is not usable: %v: %s", err, output)
+		}
+	}
+	git("init", "-q")
+	writeTree(t, root, map[string]string{"main.go": "package main\n\nfunc main() {}\n"})
+	git("add", ".")
+	git("commit", "-q", "-m", "initial commit")
+	writeTree(t, root, map[string]string{"main.go": "package main\n\nfunc main() { println(\"staged\") }\n"})
+	git("add", ".")
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nfunc main() { println(\"unstaged\") }\n"), 0o644))
+	return root
+}
+
+func TestGitContext(t *testing.T) {
+	root := setupGitRepo(t)
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+
+	tests := []testutils.TableTest{
+		{Name: "worktree", Input: CallArgs{GitDiff: GitDiffWorktree}, Expected: `+func main() { println("unstaged") }`},
+		{Name: "staged", Input: CallArgs{GitDiff: GitDiffStaged}, Expected: `+func main() { println("staged") }`},
+		{Name: "against ref", Input: CallArgs{GitDiff: "HEAD"}, Expected: `<git_diff against="HEAD">`},
+		{Name: "log", Input: CallArgs{GitLog: 1}, Expected: "initial commit"},
+		{Name: "blame range", Input: CallArgs{GitBlame: []string{"main.go:3-3"}}, Expected: `lines="3-3">`},
+		{Name: "blame symbol", Input: CallArgs{GitBlame: []string{"main.go#main"}}, Expected: "func main()"},
+		{Name: "option as ref", Input: CallArgs{GitDiff: "--output=/tmp/x"}, WantErr: true},
+		{Name: "unknown ref", Input: CallArgs{GitDiff: "nope"}, WantErr: true},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		args := tt.Input.(CallArgs)
+		args.Cwd = root
+		items, err := s.gitContext(context.Background(), args, &contextReport{})
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+			return
+		}
+		testutils.AssertNoError(t, err)
+		testutils.AssertContains(t, encodeItems(ContextFormatXML, items), tt.Expected.(string))
+	})
+}
+
+func TestGitContextSkipsRepoDrivers(t *testing.T) {
+	root := setupGitRepo(t)
+	marker := filepath.Join(t.TempDir(), "ran")
+	hook := filepath.Join(t.TempDir(), "hook")
+	testutils.AssertNoError(t, os.WriteFile(hook, []byte("#!/bin/sh\ntouch "+marker+"\ncat\n"), 0o755))
+	writeTree(t, root, map[string]string{".gitattributes": "*.go diff=evil filter=evil\n"})
+	config := "[diff \"evil\"]\n\tcommand = " + hook + "\n\ttextconv = " + hook + "\n" +
+		"[filter \"evil\"]\n\tclean = " + hook + "\n\tsmudge = " + hook + "\n\trequired = true\n" +
+		"[core]\n\tfsmonitor = " + hook + "\n"
+	f, err := os.OpenFile(filepath.Join(root, ".git", "config"), os.O_APPEND|os.O_WRONLY, 0)
+	testutils.AssertNoError(t, err)
+	_, err = f.WriteString(config)
+	testutils.AssertNoError(t, err)
+	testutils.AssertNoError(t, f.Close())
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+	args := CallArgs{Cwd: root, GitDiff: GitDiffWorktree, GitLog: 1, GitBlame: []string{"main.go"}}
+	_, err = s.gitContext(context.Background(), args, &contextReport{})
+	testutils.AssertNoError(t, err)
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("Expected the repository's diff driver, filter and fsmonitor hook not to run")
+	}
+}
+
+func TestGitContextChecksWorkingDirectory(t *testing.T) {
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Exec: ExecPolicy{AllowedRoots: []string{t.TempDir()}}})
+	_, err := s.gitContext(context.Background(), CallArgs{GitLog: 1}, &contextReport{})
+	testutils.AssertError(t, err)
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxJSONRepairs bounds the calls made to fix a reply that isn't valid JSON
+// or doesn't match the schema.
+const maxJSONRepairs = 2
+
+const repairPrompt = "The reply above should be JSON%s, but it has these problems:\n%s\n" +
+	"Reply with the corrected JSON only, keeping the content of the reply."
+
+// schemaPrompt asks for a reply matching the schema; mods has no native
+// structured output, so the schema goes into the prompt.
+func schemaPrompt(schema map[string]any) string {
+	data, _ := json.MarshalIndent(schema, "", "  ")
+	return "\n\nReply with JSON only, matching this JSON Schema:\n" + string(data)
+}
+
+// ensureJSON validates a json_output reply and has the model repair it until
+// it's valid or the repairs run out. It returns the JSON, stripped of any
+// code fence, or the last raw reply and what's wrong with it.
+func (s *BaseServer) ensureJSON(ctx context.Context, tool string, a CallArgs, output string) (string, []string) {
+	progress := ProgressFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		text := stripCodeFence(output)
+		errs := validateJSON(text, a.JSONSchema)
+		if len(errs) == 0 {
+			return text, nil
+		}
+		if attempt > maxJSONRepairs {
+			return output, errs
+		}
+
+		progress.Report(fmt.Sprintf("repairing invalid JSON, attempt %d of %d", attempt, maxJSONRepairs))
+		repaired, err := s.repairJSON(ctx, tool, a, output, errs)
+		if err != nil {
+			return output, append(errs, fmt.Sprintf("repair failed: %v", err))
+		}
+		output = repaired
+	}
+}
+
+// repairJSON sends only the invalid reply back, without the context of the
+// call; fixing its shape doesn't need it.
+func (s *BaseServer) repairJSON(ctx context.Context, tool string, a CallArgs, output string, errs []string) (string, error) {
+	matching := ""
+	if a.JSONSchema != nil {
+		matching = " matching the schema below"
+	}
+	prompt := fmt.Sprintf(repairPrompt, matching, "- "+strings.Join(errs, "\n- "))
+	if a.JSONSchema != nil {
+		prompt += schemaPrompt(a.JSONSchema)
+	}
+
+	repair := CallArgs{Prompt: " " + prompt, JsonOutput: true, Role: a.Role, Readonly: a.Readonly, Cwd: a.Cwd, Model: a.Model}
+	cmd := s.buildModsCmd(ctx, repair)
+	cmd.Stdin = strings.NewReader(encodeItems(s.contextFormat(tool), []contextItem{
+		{Kind: "reply", Sections: []section{{Text: output}}},
+	}))
+	stdout, stderr, err := runCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("%v, stderr: %s", err, stderr)
+	}
+	return stdout, nil
+}
+
+// stripCodeFence unwraps a reply that is a single fenced code block, as
+// models tend to send JSON.
+func stripCodeFence(output string) string {
+	text := strings.TrimSpace(output)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") {
+		return text
+	}
+	_, body, ok := strings.Cut(text, "\n")
+	if !ok {
+		return text
+	}
+	return strings.TrimSpace(strings.TrimSuffix(body, "```"))
+}
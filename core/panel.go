@@ -0,0 +1,289 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anuramat/modagent/audit"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Aggregation methods of junior-panel.
+const (
+	AggregateNone       = "none"
+	AggregateVote       = "vote"
+	AggregateSynthesize = "synthesize"
+	AggregateJudge      = "judge"
+)
+
+const maxPanelMembers = 8
+
+const synthesisPrompt = "Several assistants answered the question above independently. " +
+	"Write the single best answer, combining what they got right and resolving their disagreements; " +
+	"don't mention the assistants. Reply with the answer only."
+
+const judgePrompt = "Several assistants answered the question above independently. " +
+	"Pick the best answer: reply with its number on the first line, then briefly explain why."
+
+var judgeChoice = regexp.MustCompile(`\d+`)
+
+// panelMember is a role or a model a junior-panel prompt is sent to; models
+// use the default read-only role.
+type panelMember struct {
+	Role  string `json:"role,omitempty"`
+	Model string `json:"model,omitempty"`
+}
+
+func (m panelMember) String() string {
+	if m.Model != "" {
+		return "model " + m.Model
+	}
+	return m.Role
+}
+
+type panelAnswer struct {
+	panelMember
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type panelArgs struct {
+	Members   []panelMember
+	Aggregate string
+	// JudgeRole synthesises or judges the answers.
+	JudgeRole string
+}
+
+func parsePanelArgs(args map[string]any) (panelArgs, error) {
+	p := panelArgs{Aggregate: AggregateNone}
+	for _, field := range []string{"roles", "models"} {
+		val, exists := args[field]
+		if !exists {
+			continue
+		}
+		names, ok := val.([]any)
+		if !ok {
+			return p, fmt.Errorf("%s must be an array of strings", field)
+		}
+		for _, n := range names {
+			name, ok := n.(string)
+			if !ok || name == "" {
+				return p, fmt.Errorf("%s must be an array of non-empty strings", field)
+			}
+			if field == "roles" {
+				p.Members = append(p.Members, panelMember{Role: name})
+			} else {
+				p.Members = append(p.Members, panelMember{Model: name})
+			}
+		}
+	}
+	if len(p.Members) < 2 || len(p.Members) > maxPanelMembers {
+		return p, fmt.Errorf("a panel needs between 2 and %d roles and models, got %d", maxPanelMembers, len(p.Members))
+	}
+
+	if val, ok := args["aggregate"].(string); ok && val != "" {
+		p.Aggregate = val
+	}
+	switch p.Aggregate {
+	case AggregateNone, AggregateVote, AggregateSynthesize, AggregateJudge:
+	default:
+		return p, fmt.Errorf("unknown aggregate %q (valid: none, vote, synthesize, judge)", p.Aggregate)
+	}
+	if val, ok := args["judge_role"].(string); ok {
+		p.JudgeRole = val
+	}
+	return p, nil
+}
+
+// checkPanelRoles refuses the write-capable default role for members and the
+// judge, since a panel is read-only.
+func checkPanelRoles(panel panelArgs, getDefaultRole func(bool) string) error {
+	writeRole := getDefaultRole(false)
+	if writeRole == getDefaultRole(true) {
+		return nil
+	}
+	roles := []string{panel.JudgeRole}
+	for _, m := range panel.Members {
+		roles = append(roles, m.Role)
+	}
+	for _, role := range roles {
+		if role == writeRole {
+			return fmt.Errorf("role %s has write access; a panel is read-only", role)
+		}
+	}
+	return nil
+}
+
+// HandlePanel sends the same prompt and context to several roles or models
+// at once, read-only, and returns every answer plus an optional aggregate.
+func (s *BaseServer) HandlePanel(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ctx = WithProgress(ctx, request)
+	params, err := ParseArgs(request.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	panel, err := parsePanelArgs(request.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if params.Conversation != "" || params.Session != "" {
+		return mcp.NewToolResultError("a panel can't continue conversations"), nil
+	}
+	if err := checkPanelRoles(panel, s.config.GetDefaultRole); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	params.Readonly = true
+
+	if params.Cwd, err = s.ResolveCwd(ctx, params.Cwd); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	stdin, report, err := s.prepareStdin(ctx, request.Params.Name, params, s.Scope(ctx, params.Cwd))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	params.Attachments = report.Attachments
+
+	labels := make([]string, len(panel.Members))
+	for i, m := range panel.Members {
+		labels[i] = m.String()
+	}
+	audit.FromContext(ctx).SetModel("mods", strings.Join(labels, ", "))
+
+	answers := s.askPanel(ctx, params, panel.Members, stdin.Bytes())
+	var succeeded []panelAnswer
+	var failures []string
+	for _, answer := range answers {
+		if answer.Error != "" {
+			failures = append(failures, answer.String()+": "+answer.Error)
+			continue
+		}
+		succeeded = append(succeeded, answer)
+	}
+	if len(succeeded) == 0 {
+		return mcp.NewToolResultError("every panel member failed: " + strings.Join(failures, "; ")), nil
+	}
+
+	responseObj := report.fields()
+	responseObj["answers"] = answers
+	if panel.Aggregate != AggregateNone {
+		ProgressFromContext(ctx).Report("aggregating answers: " + panel.Aggregate)
+		aggregate, err := s.aggregatePanel(ctx, request.Params.Name, params, panel, succeeded)
+		if err != nil {
+			responseObj["aggregate_error"] = err.Error()
+		} else {
+			responseObj["aggregate"] = aggregate
+		}
+	}
+
+	jsonBytes, _ := json.Marshal(responseObj)
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// askPanel runs mods for every member concurrently, with the same stdin.
+func (s *BaseServer) askPanel(ctx context.Context, params CallArgs, members []panelMember, stdin []byte) []panelAnswer {
+	progress := ProgressFromContext(ctx)
+	progress.Report(fmt.Sprintf("asking %d panel members", len(members)))
+
+	answers := make([]panelAnswer, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a := params
+			a.Role, a.Model = m.Role, m.Model
+			cmd := s.buildModsCmd(ctx, a)
+			cmd.Stdin = bytes.NewReader(stdin)
+			stdout, stderr, err := runCommand(cmd)
+
+			answers[i] = panelAnswer{panelMember: m, Response: stdout}
+			if err != nil {
+				answers[i].Error = fmt.Sprintf("command failed: %v, stderr: %s", err, stderr)
+				progress.Report(m.String() + " failed")
+				return
+			}
+			progress.Report(m.String() + " answered")
+		}()
+	}
+	wg.Wait()
+	return answers
+}
+
+func (s *BaseServer) aggregatePanel(ctx context.Context, tool string, params CallArgs, panel panelArgs, answers []panelAnswer) (map[string]any, error) {
+	if panel.Aggregate == AggregateVote {
+		return vote(answers), nil
+	}
+
+	items := []contextItem{{Kind: "question", Sections: []section{{Text: strings.TrimSpace(params.Prompt)}}}}
+	for i, answer := range answers {
+		items = append(items, contextItem{
+			Kind:     "answer",
+			Attrs:    []attr{{Name: "number", Value: strconv.Itoa(i + 1)}},
+			Sections: []section{{Text: answer.Response}},
+		})
+	}
+	prompt := synthesisPrompt
+	if panel.Aggregate == AggregateJudge {
+		prompt = judgePrompt
+	}
+	a := CallArgs{Prompt: " " + prompt, Role: panel.JudgeRole, Readonly: true, Cwd: params.Cwd}
+	cmd := s.buildModsCmd(ctx, a)
+	cmd.Stdin = strings.NewReader(encodeItems(s.contextFormat(tool), items))
+	stdout, stderr, err := runCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v, stderr: %s", panel.Aggregate, err, stderr)
+	}
+
+	aggregate := map[string]any{"method": panel.Aggregate, "role": resolveRole(a, s.config.GetDefaultRole)}
+	if panel.Aggregate == AggregateSynthesize {
+		aggregate["answer"] = stdout
+		return aggregate, nil
+	}
+
+	first, rationale, _ := strings.Cut(strings.TrimSpace(stdout), "\n")
+	choice, err := strconv.Atoi(judgeChoice.FindString(first))
+	if err != nil || choice < 1 || choice > len(answers) {
+		return nil, fmt.Errorf("judge didn't pick an answer: %s", stdout)
+	}
+	aggregate["choice"] = answers[choice-1].panelMember
+	aggregate["answer"] = answers[choice-1].Response
+	aggregate["rationale"] = strings.TrimSpace(rationale)
+	return aggregate, nil
+}
+
+// vote picks the most common answer, comparing them case-insensitively and
+// ignoring whitespace and trailing punctuation; ties go to the first member.
+func vote(answers []panelAnswer) map[string]any {
+	counts := map[string]int{}
+	for _, answer := range answers {
+		counts[normaliseVote(answer.Response)]++
+	}
+	var winner panelAnswer
+	best, leaders := 0, 0
+	for _, answer := range answers {
+		switch n := counts[normaliseVote(answer.Response)]; {
+		case n > best:
+			best, leaders, winner = n, 1, answer
+		case n == best && normaliseVote(answer.Response) != normaliseVote(winner.Response):
+			leaders++
+		}
+	}
+	return map[string]any{
+		"method": AggregateVote,
+		"answer": strings.TrimSpace(winner.Response),
+		"votes":  best,
+		"of":     len(answers),
+		"tie":    leaders > 1,
+	}
+}
+
+func normaliseVote(answer string) string {
+	answer = strings.Join(strings.Fields(strings.ToLower(answer)), " ")
+	return strings.TrimRight(answer, ".!")
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// panelMods answers with its role and model; the judge role picks the
+// second answer and the broken role fails.
+const panelMods = `cat >/dev/null
+role= model=
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -R) role=$2; shift ;;
+    -m) model=$2; shift ;;
+  esac
+  shift
+done
+case "$role" in
+  judge) printf '2\nmost thorough\n' ;;
+  broken) echo oops >&2; exit 1 ;;
+  *) echo "$role $model" ;;
+esac
+`
+
+func TestParsePanelArgs(t *testing.T) {
+	tests := []testutils.TableTest{
+		{Name: "roles and models", Input: map[string]any{"roles": []any{"a"}, "models": []any{"gpt"}}, Expected: 2},
+		{Name: "single member", Input: map[string]any{"roles": []any{"a"}}, WantErr: true},
+		{Name: "too many", Input: map[string]any{"roles": []any{"1", "2", "3", "4", "5", "6", "7", "8", "9"}}, WantErr: true},
+		{Name: "empty role", Input: map[string]any{"roles": []any{"a", ""}}, WantErr: true},
+		{Name: "not an array", Input: map[string]any{"roles": "a,b"}, WantErr: true},
+		{Name: "unknown aggregate", Input: map[string]any{"roles": []any{"a", "b"}, "aggregate": "average"}, WantErr: true},
+	}
+
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		panel, err := parsePanelArgs(tt.Input.(map[string]any))
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+			return
+		}
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, tt.Expected, len(panel.Members))
+	})
+}
+
+func TestVote(t *testing.T) {
+	answers := func(responses ...string) []panelAnswer {
+		var list []panelAnswer
+		for _, r := range responses {
+			list = append(list, panelAnswer{Response: r})
+		}
+		return list
+	}
+
+	result := vote(answers("Yes.\n", "no", "yes"))
+	testutils.AssertEqual(t, "Yes.", result["answer"])
+	testutils.AssertEqual(t, 2, result["votes"])
+	testutils.AssertEqual(t, false, result["tie"])
+
+	result = vote(answers("no", "yes", "yes", "no"))
+	testutils.AssertEqual(t, "no", result["answer"])
+	testutils.AssertEqual(t, true, result["tie"])
+}
+
+func TestHandlePanel(t *testing.T) {
+	fakeTool(t, "mods", panelMods)
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+	members := []any{"reviewer", "broken"}
+
+	tests := []testutils.TableTest{
+		{Name: "no aggregate", Input: map[string]any{}, Expected: nil},
+		{Name: "judge", Input: map[string]any{"aggregate": AggregateJudge, "judge_role": "judge"}, Expected: "default gpt\n"},
+		{Name: "synthesize", Input: map[string]any{"aggregate": AggregateSynthesize, "judge_role": "writer"}, Expected: "writer \n"},
+	}
+
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		args := tt.Input.(map[string]any)
+		args["prompt"] = "is this right?"
+		args["cwd"] = t.TempDir()
+		args["roles"] = members
+		args["models"] = []any{"gpt"}
+		result, err := s.HandlePanel(context.Background(), testutils.CreateMCPRequest("junior-panel", args))
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, false, result.IsError)
+
+		var response struct {
+			Answers   []panelAnswer  `json:"answers"`
+			Aggregate map[string]any `json:"aggregate"`
+		}
+		testutils.AssertNoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response))
+		testutils.AssertEqual(t, 3, len(response.Answers))
+		testutils.AssertEqual(t, "reviewer \n", response.Answers[0].Response)
+		testutils.AssertContains(t, response.Answers[1].Error, "oops")
+		testutils.AssertEqual(t, "gpt", response.Answers[2].Model)
+		if tt.Expected == nil {
+			testutils.AssertEqual(t, 0, len(response.Aggregate))
+			return
+		}
+		testutils.AssertEqual(t, tt.Expected, response.Aggregate["answer"])
+	})
+}
+
+func TestHandlePanelRejectsWriteRole(t *testing.T) {
+	config := &testutils.MockConfig{DefaultRoles: map[bool]string{true: "junior-r", false: "junior-rwx"}}
+	s := NewBaseServer(config, Options{})
+	for _, args := range []map[string]any{
+		{"prompt": "q", "roles": []any{"junior-r", "junior-rwx"}},
+		{"prompt": "q", "roles": []any{"a", "b"}, "aggregate": AggregateJudge, "judge_role": "junior-rwx"},
+	} {
+		result, err := s.HandlePanel(context.Background(), testutils.CreateMCPRequest("junior-panel", args))
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, true, result.IsError)
+		testutils.AssertContains(t, result.Content[0].(mcp.TextContent).Text, "write access")
+	}
+}
+
+func TestHandlePanelRejectsConversations(t *testing.T) {
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+	args := map[string]any{"prompt": "q", "roles": []any{"a", "b"}, "session": "review"}
+	result, err := s.HandlePanel(context.Background(), testutils.CreateMCPRequest("junior-panel", args))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, true, result.IsError)
+}
+
+func TestHandlePanelBudget(t *testing.T) {
+	// Members answer with the size of their input
+	fakeTool(t, "mods", "wc -c\n")
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"big.txt": strings.Repeat("lorem ipsum\n", 2000)})
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Budgets: map[string]Budget{
+		"junior-panel": {MaxTokens: 500, Estimator: DefaultEstimator},
+	}})
+
+	args := map[string]any{"prompt": "summarize", "cwd": dir, "roles": []any{"a", "b"}, "filepaths": []any{"big.txt"}}
+	result, err := s.HandlePanel(context.Background(), testutils.CreateMCPRequest("junior-panel", args))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, false, result.IsError)
+
+	var response struct {
+		Answers []panelAnswer `json:"answers"`
+		Budget  budgetReport  `json:"budget"`
+	}
+	testutils.AssertNoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response))
+	testutils.AssertEqual(t, 1, len(response.Budget.Trimmed))
+	for _, answer := range response.Answers {
+		size, err := strconv.Atoi(strings.TrimSpace(answer.Response))
+		testutils.AssertNoError(t, err)
+		if float64(size) > 500*DefaultEstimator.CharsPerToken {
+			t.Fatalf("Expected the context trimmed to the budget, %s got %d bytes", answer, size)
+		}
+	}
+}
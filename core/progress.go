@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Progress sends MCP progress notifications for a single tool call. A nil
+// Progress discards all reports, so callers never have to check whether the
+// client asked for progress.
+type Progress struct {
+	ctx   context.Context
+	token mcp.ProgressToken
+	mu    sync.Mutex
+	step  float64
+}
+
+type progressKey struct{}
+
+// WithProgress attaches a progress reporter to ctx if the client supplied a
+// progress token and no reporter is attached yet.
+func WithProgress(ctx context.Context, request mcp.CallToolRequest) context.Context {
+	if ProgressFromContext(ctx) != nil {
+		return ctx
+	}
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return ctx
+	}
+	p := &Progress{ctx: ctx, token: request.Params.Meta.ProgressToken}
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// ProgressFromContext returns the reporter of the current call, or nil.
+func ProgressFromContext(ctx context.Context) *Progress {
+	p, _ := ctx.Value(progressKey{}).(*Progress)
+	return p
+}
+
+// WithoutProgress detaches the reporter of the current call from ctx, for
+// work that outlives the call.
+func WithoutProgress(ctx context.Context) context.Context {
+	if ProgressFromContext(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, (*Progress)(nil))
+}
+
+// Report sends a progress notification with a monotonically increasing
+// progress value.
+func (p *Progress) Report(message string) {
+	if p == nil {
+		return
+	}
+	srv := server.ServerFromContext(p.ctx)
+	if srv == nil {
+		return
+	}
+	p.mu.Lock()
+	p.step++
+	step := p.step
+	p.mu.Unlock()
+
+	notification := mcp.NewProgressNotification(p.token, step, nil, &message)
+	_ = srv.SendNotificationToClient(p.ctx, notification.Method, map[string]any{
+		"progressToken": notification.Params.ProgressToken,
+		"progress":      notification.Params.Progress,
+		"message":       notification.Params.Message,
+	})
+}
+
+// streamInterval is the shortest time between two notifications carrying
+// streamed output.
+const streamInterval = 250 * time.Millisecond
+
+// Stream returns a writer that forwards output as progress notifications,
+// batched into complete lines at most every streamInterval. Flush sends
+// whatever is left once the output ends.
+func (p *Progress) Stream() *ProgressStream {
+	return &ProgressStream{progress: p}
+}
+
+type ProgressStream struct {
+	progress *Progress
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	last     time.Time
+}
+
+var _ io.Writer = (*ProgressStream)(nil)
+
+func (w *ProgressStream) Write(b []byte) (int, error) {
+	if w.progress == nil {
+		return len(b), nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(b)
+	if time.Since(w.last) < streamInterval {
+		return len(b), nil
+	}
+	if end := bytes.LastIndexByte(w.buf.Bytes(), '\n'); end >= 0 {
+		w.send(w.buf.Next(end + 1))
+	}
+	return len(b), nil
+}
+
+func (w *ProgressStream) Flush() {
+	if w.progress == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() > 0 {
+		w.send(w.buf.Next(w.buf.Len()))
+	}
+}
+
+func (w *ProgressStream) send(chunk []byte) {
+	w.last = time.Now()
+	w.progress.Report(string(chunk))
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type testSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *testSession) Initialize()       {}
+func (s *testSession) Initialized() bool { return true }
+func (s *testSession) SessionID() string { return "test" }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestStreamProgress(t *testing.T) {
+	fakeTool(t, "mods", "cat >/dev/null\necho one\nsleep 0.3\nprintf two\n")
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-progress-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+
+	s := NewBaseServer(&testutils.MockConfig{}, Options{Artifacts: artifacts.NewStore(dir)})
+	mcpServer := server.NewMCPServer("test", "0")
+	mcpServer.AddTool(mcp.NewTool("junior-r"), s.HandleCallReadonly)
+	session := &testSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	ctx := mcpServer.WithContext(context.Background(), session)
+
+	message, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]any{
+			"name":      "junior-r",
+			"arguments": map[string]any{"prompt": "hi", "bash_cmd": "true"},
+			"_meta":     map[string]any{"progressToken": "token"},
+		},
+	})
+	testutils.AssertNoError(t, err)
+	mcpServer.HandleMessage(ctx, message)
+	close(session.notifications)
+
+	var messages []string
+	for notification := range session.notifications {
+		testutils.AssertEqual(t, "notifications/progress", notification.Method)
+		messages = append(messages, notification.Params.AdditionalFields["message"].(string))
+	}
+	expected := []string{
+		"running bash_cmd: true",
+		"bash_cmd exited with status 0: true",
+		"waiting for model",
+		"one\n",
+		"two",
+	}
+	testutils.AssertEqual(t, len(expected), len(messages))
+	for i := range expected {
+		testutils.AssertEqual(t, expected[i], messages[i])
+	}
+}
+
+func TestStreamWithoutProgress(t *testing.T) {
+	var p *Progress
+	stream := p.Stream()
+	n, err := stream.Write([]byte("output\n"))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 7, n)
+	stream.Flush()
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// RedactionPolicy configures masking of secrets in context sent to the model.
+type RedactionPolicy struct {
+	Enabled     bool
+	HighEntropy bool
+	// Patterns holds additional user-supplied regular expressions.
+	Patterns []string
+}
+
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+	// group selects the submatch to mask; 0 masks the whole match.
+	group int
+}
+
+var builtinSecretPatterns = []secretPattern{
+	{kind: "private_key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{kind: "aws_access_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "github_token", re: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`)},
+	{kind: "github_token", re: regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,255}\b`)},
+	{kind: "slack_token", re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{kind: "api_key", re: regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}\b`)},
+	{
+		kind:  "env_secret",
+		re:    regexp.MustCompile(`(?im)^[ \t]*(?:export[ \t]+)?[A-Za-z0-9_]*(?:TOKEN|SECRET|PASSWORD|PASSWD|API_?KEY|PRIVATE_KEY|ACCESS_KEY|CREDENTIALS?)[A-Za-z0-9_]*[ \t]*[=:][ \t]*["']?([^\s"'#]+)`),
+		group: 1,
+	},
+}
+
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`)
+
+const entropyThreshold = 4.5
+
+// Redactor masks secrets in text.
+type Redactor struct {
+	patterns    []secretPattern
+	highEntropy bool
+}
+
+// NewRedactor compiles the policy; a disabled policy yields a nil Redactor,
+// which leaves text untouched.
+func NewRedactor(policy RedactionPolicy) (*Redactor, error) {
+	if !policy.Enabled {
+		return nil, nil
+	}
+	r := &Redactor{
+		patterns:    append([]secretPattern{}, builtinSecretPatterns...),
+		highEntropy: policy.HighEntropy,
+	}
+	for _, pattern := range policy.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", pattern, err)
+		}
+		r.patterns = append(r.patterns, secretPattern{kind: "custom", re: re})
+	}
+	return r, nil
+}
+
+// Redact returns text with secrets masked and the number of redactions.
+func (r *Redactor) Redact(text string) (string, int) {
+	if r == nil {
+		return text, 0
+	}
+	count := 0
+	for _, p := range r.patterns {
+		text = p.re.ReplaceAllStringFunc(text, func(match string) string {
+			if strings.Contains(match, "[REDACTED:") {
+				return match
+			}
+			count++
+			if p.group == 0 {
+				return mask(p.kind)
+			}
+			sub := p.re.FindStringSubmatchIndex(match)
+			if len(sub) <= 2*p.group || sub[2*p.group] < 0 {
+				return mask(p.kind)
+			}
+			return match[:sub[2*p.group]] + mask(p.kind) + match[sub[2*p.group+1]:]
+		})
+	}
+	if r.highEntropy {
+		text = entropyCandidate.ReplaceAllStringFunc(text, func(match string) string {
+			if shannonEntropy(match) < entropyThreshold || !hasLetterAndDigit(match) {
+				return match
+			}
+			count++
+			return mask("high_entropy")
+		})
+	}
+	return text, count
+}
+
+func mask(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+func shannonEntropy(s string) float64 {
+	freq := make(map[rune]float64)
+	for _, c := range s {
+		freq[c]++
+	}
+	entropy := 0.0
+	n := float64(len(s))
+	for _, f := range freq {
+		p := f / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func hasLetterAndDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789") &&
+		strings.ContainsAny(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
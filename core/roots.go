@@ -0,0 +1,135 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const rootsRequestTimeout = 5 * time.Second
+
+// RootsPolicy configures enforcement of the client's MCP roots.
+type RootsPolicy struct {
+	// Enforce rejects filepaths and cwd values outside of the client roots.
+	Enforce bool
+	// Extra lists locations that are always accessible, e.g. ~/.config.
+	Extra []string
+}
+
+// Roots resolves and caches the roots advertised by each client session.
+type Roots struct {
+	policy    RootsPolicy
+	mu        sync.Mutex
+	bySession map[string][]string
+}
+
+func NewRoots(policy RootsPolicy) *Roots {
+	return &Roots{
+		policy:    policy,
+		bySession: make(map[string][]string),
+	}
+}
+
+// HandleListChanged drops the cached roots of the notifying session.
+func (r *Roots) HandleListChanged(ctx context.Context, notification mcp.JSONRPCNotification) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return
+	}
+	r.mu.Lock()
+	delete(r.bySession, session.SessionID())
+	r.mu.Unlock()
+}
+
+// HandleUnregisterSession forgets the roots of a session that has ended.
+func (r *Roots) HandleUnregisterSession(ctx context.Context, session server.ClientSession) {
+	r.mu.Lock()
+	delete(r.bySession, session.SessionID())
+	r.mu.Unlock()
+}
+
+// Check returns an error if path is outside of the client roots and the
+// configured extra locations. Symlinks are resolved before comparison.
+func (r *Roots) Check(ctx context.Context, path string) error {
+	if r == nil || !r.policy.Enforce {
+		return nil
+	}
+	if _, err := filepath.EvalSymlinks(path); err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+
+	roots, err := r.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, root := range append(roots, r.policy.Extra...) {
+		if isWithinResolved(path, root) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is outside of the client roots", path)
+}
+
+// List returns the roots advertised by the client of the current session.
+func (r *Roots) List(ctx context.Context) ([]string, error) {
+	if r == nil {
+		return nil, nil
+	}
+	return r.list(ctx)
+}
+
+func (r *Roots) list(ctx context.Context) ([]string, error) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	roots, cached := r.bySession[session.SessionID()]
+	r.mu.Unlock()
+	if cached {
+		return roots, nil
+	}
+
+	if info, ok := session.(server.SessionWithClientInfo); ok && info.GetClientCapabilities().Roots == nil {
+		return nil, nil
+	}
+	srv := server.ServerFromContext(ctx)
+	if srv == nil {
+		return nil, nil
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, rootsRequestTimeout)
+	defer cancel()
+	result, err := srv.RequestRoots(reqCtx, mcp.ListRootsRequest{})
+	if err == server.ErrRootsNotSupported {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list client roots: %v", err)
+	}
+
+	roots = rootPaths(result.Roots)
+	r.mu.Lock()
+	r.bySession[session.SessionID()] = roots
+	r.mu.Unlock()
+	return roots, nil
+}
+
+func rootPaths(roots []mcp.Root) []string {
+	var paths []string
+	for _, root := range roots {
+		u, err := url.Parse(root.URI)
+		if err != nil || u.Scheme != "file" || !filepath.IsAbs(u.Path) {
+			continue
+		}
+		paths = append(paths, filepath.Clean(u.Path))
+	}
+	return paths
+}
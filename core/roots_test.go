@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestRootsCheck(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-roots-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+
+	shared := filepath.Join(dir, "shared")
+	private := filepath.Join(dir, "private")
+	testutils.AssertNoError(t, os.MkdirAll(shared, 0o755))
+	testutils.AssertNoError(t, os.MkdirAll(private, 0o755))
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(shared, "ok"), nil, 0o644))
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(private, "secret"), nil, 0o644))
+	testutils.AssertNoError(t, os.Symlink(filepath.Join(private, "secret"), filepath.Join(shared, "link")))
+
+	roots := NewRoots(RootsPolicy{Enforce: true, Extra: []string{shared}})
+
+	tests := []testutils.TableTest{
+		{Name: "inside extra", Input: filepath.Join(shared, "ok")},
+		{Name: "extra itself", Input: shared},
+		{Name: "outside", Input: filepath.Join(private, "secret"), WantErr: true},
+		{Name: "symlink escaping extra", Input: filepath.Join(shared, "link"), WantErr: true},
+		{Name: "missing file", Input: filepath.Join(shared, "missing"), WantErr: true},
+	}
+
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		err := roots.Check(context.Background(), tt.Input.(string))
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+		} else {
+			testutils.AssertNoError(t, err)
+		}
+	})
+}
+
+func TestRootsCheckDisabled(t *testing.T) {
+	var nilRoots *Roots
+	testutils.AssertNoError(t, nilRoots.Check(context.Background(), "/etc/passwd"))
+	testutils.AssertNoError(t, NewRoots(RootsPolicy{}).Check(context.Background(), "/etc/passwd"))
+}
+
+func TestRootPaths(t *testing.T) {
+	paths := rootPaths([]mcp.Root{
+		{URI: "file:///home/user/repo/"},
+		{URI: "https://example.com/repo"},
+		{URI: "file://relative"},
+	})
+	testutils.AssertEqual(t, 1, len(paths))
+	testutils.AssertEqual(t, "/home/user/repo", paths[0])
+}
+
+func TestRootsForgetUnregisteredSession(t *testing.T) {
+	roots := NewRoots(RootsPolicy{Enforce: true})
+	session := &testSession{}
+	roots.bySession[session.SessionID()] = []string{"/src/a"}
+
+	roots.HandleUnregisterSession(context.Background(), session)
+	testutils.AssertEqual(t, 0, len(roots.bySession))
+}
@@ -0,0 +1,291 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The validator covers the subset of JSON Schema that describes the shape of
+// a reply: type, enum, const, object properties, array items, length and
+// range bounds, pattern, and the allOf/anyOf/oneOf combinators. Other
+// keywords are annotations and ignored, except $ref, which is rejected
+// rather than silently skipped.
+
+var schemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+// checkSchema rejects schemas the validator can't apply.
+func checkSchema(schema map[string]any, path string) error {
+	if _, ok := schema["$ref"]; ok {
+		return fmt.Errorf("json_schema: $ref is not supported (at %s)", path)
+	}
+	for _, t := range schemaTypeNames(schema["type"]) {
+		if !schemaTypes[t] {
+			return fmt.Errorf("json_schema: unknown type %q (at %s)", t, path)
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("json_schema: invalid pattern at %s: %v", path, err)
+		}
+	}
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		for name, sub := range properties {
+			if sub, ok := sub.(map[string]any); ok {
+				if err := checkSchema(sub, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties"} {
+		if sub, ok := schema[key].(map[string]any); ok {
+			if err := checkSchema(sub, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, _ := schema[key].([]any)
+		for i, sub := range subs {
+			if sub, ok := sub.(map[string]any); ok {
+				if err := checkSchema(sub, fmt.Sprintf("%s.%s[%d]", path, key, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func schemaTypeNames(val any) []string {
+	switch val := val.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		var names []string
+		for _, v := range val {
+			if name, ok := v.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// validateJSON parses text and checks it against schema, which may be nil;
+// it returns what's wrong with it, if anything.
+func validateJSON(text string, schema map[string]any) []string {
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	var errs []string
+	if schema != nil {
+		validateValue(value, schema, "$", &errs)
+	}
+	return errs
+}
+
+func validateValue(value any, schema map[string]any, path string, errs *[]string) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypeNames(schema["type"]); len(types) > 0 && !matchesType(value, types) {
+		fail("expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsValue(enum, value) {
+		fail("must be one of %s", compactJSON(enum))
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, value) {
+		fail("must be %s", compactJSON(c))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		validateObject(value, schema, path, errs)
+	case []any:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(value)) < n {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(value)) > n {
+			fail("must have at most %v items", n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range value {
+				validateValue(item, items, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(value))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("must be at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("must be at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+				fail("must match %s", pattern)
+			}
+		}
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && value < n {
+			fail("must be at least %v", n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && value > n {
+			fail("must be at most %v", n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMinimum"); ok && value <= n {
+			fail("must be greater than %v", n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMaximum"); ok && value >= n {
+			fail("must be less than %v", n)
+		}
+	}
+
+	validateCombinators(value, schema, path, errs)
+}
+
+func validateObject(value map[string]any, schema map[string]any, path string, errs *[]string) {
+	required, _ := schema["required"].([]any)
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			if _, present := value[name]; !present {
+				*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	// Sorted so that repeated validations report errors in the same order
+	sort.Strings(names)
+	for _, name := range names {
+		if sub, ok := properties[name].(map[string]any); ok {
+			validateValue(value[name], sub, path+"."+name, errs)
+			continue
+		}
+		if _, ok := properties[name]; ok {
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, fmt.Sprintf("%s: unexpected property %q", path, name))
+			}
+		case map[string]any:
+			validateValue(value[name], additional, path+"."+name, errs)
+		}
+	}
+}
+
+func validateCombinators(value any, schema map[string]any, path string, errs *[]string) {
+	matches := func(sub any) bool {
+		subSchema, ok := sub.(map[string]any)
+		if !ok {
+			return true
+		}
+		var subErrs []string
+		validateValue(value, subSchema, path, &subErrs)
+		return len(subErrs) == 0
+	}
+
+	if subs, ok := schema["allOf"].([]any); ok {
+		for _, sub := range subs {
+			if subSchema, ok := sub.(map[string]any); ok {
+				validateValue(value, subSchema, path, errs)
+			}
+		}
+	}
+	if subs, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range subs {
+			if matches(sub) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			*errs = append(*errs, path+": must match at least one schema of anyOf")
+		}
+	}
+	if subs, ok := schema["oneOf"].([]any); ok {
+		count := 0
+		for _, sub := range subs {
+			if matches(sub) {
+				count++
+			}
+		}
+		if count != 1 {
+			*errs = append(*errs, fmt.Sprintf("%s: must match exactly one schema of oneOf, matches %d", path, count))
+		}
+	}
+}
+
+func matchesType(value any, types []string) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsValue(list []any, value any) bool {
+	for _, v := range list {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func compactJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+var personSchema = map[string]any{
+	"type":     "object",
+	"required": []any{"name", "tags"},
+	"properties": map[string]any{
+		"name": map[string]any{"type": "string", "minLength": float64(1)},
+		"age":  map[string]any{"type": "integer", "minimum": float64(0)},
+		"tags": map[string]any{"type": "array", "items": map[string]any{"enum": []any{"a", "b"}}},
+		"kind": map[string]any{"oneOf": []any{
+			map[string]any{"const": "human"},
+			map[string]any{"type": "string", "pattern": "^bot-"},
+		}},
+	},
+	"additionalProperties": false,
+}
+
+func TestValidateJSON(t *testing.T) {
+	tests := []testutils.TableTest{
+		{Name: "valid", Input: `{"name": "x", "age": 3, "tags": ["a"], "kind": "bot-1"}`, Expected: ""},
+		{Name: "not JSON", Input: `name: x`, Expected: "invalid JSON"},
+		{Name: "missing property", Input: `{"name": "x"}`, Expected: `$: missing required property "tags"`},
+		{Name: "wrong type", Input: `{"name": 1, "tags": []}`, Expected: "$.name: expected string, got integer"},
+		{Name: "not an integer", Input: `{"name": "x", "age": 1.5, "tags": []}`, Expected: "$.age: expected integer, got number"},
+		{Name: "below minimum", Input: `{"name": "x", "age": -1, "tags": []}`, Expected: "$.age: must be at least 0"},
+		{Name: "enum", Input: `{"name": "x", "tags": ["c"]}`, Expected: `$.tags[0]: must be one of ["a","b"]`},
+		{Name: "additional property", Input: `{"name": "x", "tags": [], "extra": 1}`, Expected: `unexpected property "extra"`},
+		{Name: "oneOf", Input: `{"name": "x", "tags": [], "kind": "alien"}`, Expected: "$.kind: must match exactly one schema of oneOf, matches 0"},
+		{Name: "too short", Input: `{"name": "", "tags": []}`, Expected: "$.name: must be at least 1 characters"},
+	}
+
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		errs := validateJSON(tt.Input.(string), personSchema)
+		if tt.Expected == "" {
+			testutils.AssertEqual(t, 0, len(errs))
+			return
+		}
+		testutils.AssertContains(t, strings.Join(errs, "\n"), tt.Expected.(string))
+	})
+}
+
+func TestStripCodeFence(t *testing.T) {
+	testutils.AssertEqual(t, `{"a": 1}`, stripCodeFence("```json\n{\"a\": 1}\n```\n"))
+	testutils.AssertEqual(t, `{"a": 1}`, stripCodeFence(` {"a": 1} `))
+}
+
+func TestEnsureJSON(t *testing.T) {
+	// Repairs succeed, unless the schema asks for the impossible
+	fakeTool(t, "mods", `cat >/dev/null
+case "$*" in
+  *impossible*) echo still wrong ;;
+  *corrected*) echo '{"name": "x", "tags": []}' ;;
+esac
+`)
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+	ctx := context.Background()
+
+	output, errs := s.ensureJSON(ctx, "junior-r", CallArgs{JSONSchema: personSchema}, "```json\n{\"name\": \"x\", \"tags\": [\"a\"]}\n```")
+	testutils.AssertEqual(t, 0, len(errs))
+	testutils.AssertEqual(t, `{"name": "x", "tags": ["a"]}`, output)
+
+	output, errs = s.ensureJSON(ctx, "junior-r", CallArgs{JSONSchema: personSchema}, "Sure! Here it is: {name: x}")
+	testutils.AssertEqual(t, 0, len(errs))
+	testutils.AssertEqual(t, `{"name": "x", "tags": []}`, output)
+
+	impossible := map[string]any{"type": "string", "description": "impossible"}
+	output, errs = s.ensureJSON(ctx, "junior-r", CallArgs{JSONSchema: impossible}, "not json")
+	testutils.AssertEqual(t, "still wrong\n", output)
+	testutils.AssertContains(t, errs[0], "invalid JSON")
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/anuramat/modagent/conversation"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Scope returns the conversation scope of a call: the MCP client session
+// (unless clients share conversations) and the project directory, which is
+// the enclosing git repository of cwd, the first client root, or the
+// server's own working directory, in that order.
+func (s *BaseServer) Scope(ctx context.Context, cwd string) conversation.Scope {
+	var scope conversation.Scope
+	if session := server.ClientSessionFromContext(ctx); session != nil && s.options.IsolateClients {
+		scope.Session = session.SessionID()
+	}
+
+	dir := cwd
+	if dir == "" {
+		if roots, err := s.options.Roots.List(ctx); err == nil && len(roots) > 0 {
+			dir = roots[0]
+		}
+	}
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	scope.Project = ProjectDir(dir)
+	return scope
+}
+
+// ResolveScope is Scope for a cwd argument, which is resolved and checked
+// like the cwd of the junior tools.
+func (s *BaseServer) ResolveScope(ctx context.Context, cwd string) (conversation.Scope, error) {
+	cwd, err := s.ResolveCwd(ctx, cwd)
+	if err != nil {
+		return conversation.Scope{}, err
+	}
+	return s.Scope(ctx, cwd), nil
+}
+
+// scopeKey is a short, filesystem-safe identifier of a scope.
+func scopeKey(scope conversation.Scope) string {
+	sum := sha256.Sum256([]byte(scope.Session + "\x00" + scope.Project))
+	return hex.EncodeToString(sum[:6])
+}
+
+// ProjectDir returns the root of the git repository containing dir, or dir
+// itself outside of a repository.
+func ProjectDir(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
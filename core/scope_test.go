@@ -0,0 +1,35 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/testutils"
+)
+
+func TestProjectDir(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-project-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+
+	repo := filepath.Join(dir, "repo")
+	nested := filepath.Join(repo, "pkg", "sub")
+	testutils.AssertNoError(t, os.MkdirAll(nested, 0o755))
+	testutils.AssertNoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0o755))
+
+	testutils.AssertEqual(t, repo, ProjectDir(nested))
+	testutils.AssertEqual(t, repo, ProjectDir(repo+"/"))
+	testutils.AssertEqual(t, dir, ProjectDir(dir))
+	testutils.AssertEqual(t, "", ProjectDir(""))
+}
+
+func TestScopeKey(t *testing.T) {
+	a := scopeKey(conversation.Scope{Session: "s1", Project: "/src/a"})
+	testutils.AssertEqual(t, 12, len(a))
+	testutils.AssertEqual(t, a, scopeKey(conversation.Scope{Session: "s1", Project: "/src/a"}))
+	if a == scopeKey(conversation.Scope{Session: "s2", Project: "/src/a"}) {
+		t.Fatal("Expected different sessions to have different keys")
+	}
+}
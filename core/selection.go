@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	lineRangeSuffix = regexp.MustCompile(`^(.+):(\d+)(?:-(\d+))?$`)
+	symbolSuffix    = regexp.MustCompile(`^(.+)#([A-Za-z_]\w*(?:\.[A-Za-z_]\w*)?)$`)
+)
+
+// selection is the part of a file a filepaths entry refers to: either a
+// line range or a Go symbol.
+type selection struct {
+	// Start and End are 1-based and inclusive; a single line has End equal
+	// to Start.
+	Start, End int
+	Symbol     string
+}
+
+// parseSelection splits a filepaths entry like "/src/main.go:120-180" or
+// "/src/server.go#BaseServer.HandleCall" into the path and the selection.
+// Entries without a selector return a nil selection.
+func parseSelection(entry string) (string, *selection, error) {
+	if m := symbolSuffix.FindStringSubmatch(entry); m != nil {
+		if !strings.HasSuffix(m[1], ".go") {
+			return "", nil, fmt.Errorf("symbol selectors are only supported for Go files: %s", entry)
+		}
+		return m[1], &selection{Symbol: m[2]}, nil
+	}
+	if m := lineRangeSuffix.FindStringSubmatch(entry); m != nil {
+		start, _ := strconv.Atoi(m[2])
+		end := start
+		if m[3] != "" {
+			end, _ = strconv.Atoi(m[3])
+		}
+		if start < 1 || end < start {
+			return "", nil, fmt.Errorf("invalid line range in %s", entry)
+		}
+		return m[1], &selection{Start: start, End: end}, nil
+	}
+	return entry, nil, nil
+}
+
+func (sel *selection) String() string {
+	if sel.Symbol != "" {
+		return "#" + sel.Symbol
+	}
+	return fmt.Sprintf(":%d-%d", sel.Start, sel.End)
+}
+
+// apply returns the selected lines of content and their original line
+// numbers. Ranges past the end of the file are clipped.
+func (sel *selection) apply(path string, content []byte) ([]byte, int, int, error) {
+	start, end := sel.Start, sel.End
+	if sel.Symbol != "" {
+		var err error
+		if start, end, err = findGoSymbol(path, content, sel.Symbol); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if start > len(lines) {
+		return nil, 0, 0, fmt.Errorf("%s has only %d lines", path, len(lines))
+	}
+	end = min(end, len(lines))
+	selected := strings.Join(lines[start-1:end], "")
+	if !strings.HasSuffix(selected, "\n") {
+		selected += "\n"
+	}
+	return []byte(selected), start, end, nil
+}
+
+// findGoSymbol returns the lines of a top-level declaration, including its
+// doc comment. symbol is a function, type, variable or constant name, or
+// Type.Method for methods.
+func findGoSymbol(path string, content []byte, symbol string) (int, int, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.ParseComments)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	lines := func(doc *ast.CommentGroup, node ast.Node) (int, int, error) {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		return fset.Position(start).Line, fset.Position(node.End()).Line, nil
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				name = receiverType(decl.Recv.List[0].Type) + "." + name
+			}
+			if name == symbol {
+				return lines(decl.Doc, decl)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				var names []*ast.Ident
+				var doc *ast.CommentGroup
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names, doc = []*ast.Ident{spec.Name}, spec.Doc
+				case *ast.ValueSpec:
+					names, doc = spec.Names, spec.Doc
+				}
+				for _, name := range names {
+					if name.Name != symbol {
+						continue
+					}
+					// Outside of a group the declaration is the spec
+					if !decl.Lparen.IsValid() {
+						return lines(decl.Doc, decl)
+					}
+					return lines(doc, spec)
+				}
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("symbol %s not found in %s", symbol, path)
+}
+
+func receiverType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(expr.X)
+	case *ast.IndexExpr:
+		return receiverType(expr.X)
+	case *ast.IndexListExpr:
+		return receiverType(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+const selectionSource = `package demo
+
+// Server serves.
+type Server[T any] struct {
+	value T
+}
+
+// Handle handles.
+func (s *Server[T]) Handle() {
+	_ = s.value
+}
+
+const (
+	// Answer is the answer.
+	Answer = 42
+	Other  = 1
+)
+
+func Handle() {}
+`
+
+func TestParseSelection(t *testing.T) {
+	tests := []testutils.TableTest{
+		{Name: "plain", Input: "/src/main.go", Expected: "/src/main.go"},
+		{Name: "range", Input: "/src/main.go:120-180", Expected: "/src/main.go:120-180"},
+		{Name: "single line", Input: "/src/main.go:7", Expected: "/src/main.go:7-7"},
+		{Name: "symbol", Input: "/src/main.go#BaseServer.HandleCall", Expected: "/src/main.go#BaseServer.HandleCall"},
+		{Name: "reversed range", Input: "/src/main.go:9-3", WantErr: true},
+		{Name: "symbol in non-Go file", Input: "/src/notes.md#Intro", WantErr: true},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		path, sel, err := parseSelection(tt.Input.(string))
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+			return
+		}
+		testutils.AssertNoError(t, err)
+		if sel != nil {
+			path += sel.String()
+		}
+		testutils.AssertEqual(t, tt.Expected, path)
+	})
+}
+
+func TestFindGoSymbol(t *testing.T) {
+	tests := []testutils.TableTest{
+		{Name: "generic type", Input: "Server", Expected: [2]int{3, 6}},
+		{Name: "method", Input: "Server.Handle", Expected: [2]int{8, 11}},
+		{Name: "grouped constant", Input: "Answer", Expected: [2]int{14, 15}},
+		{Name: "function", Input: "Handle", Expected: [2]int{19, 19}},
+		{Name: "missing", Input: "Server.Missing", WantErr: true},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		start, end, err := findGoSymbol("demo.go", []byte(selectionSource), tt.Input.(string))
+		if tt.WantErr {
+			testutils.AssertError(t, err)
+			return
+		}
+		testutils.AssertNoError(t, err)
+		testutils.AssertEqual(t, tt.Expected, [2]int{start, end})
+	})
+}
+
+func TestCollectFilesSelections(t *testing.T) {
+	root, cleanup, err := testutils.CreateTempDir("modagent-test-selection-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	writeTree(t, root, map[string]string{"demo.go": selectionSource})
+	s := NewBaseServer(&testutils.MockConfig{}, Options{})
+
+	_, _, err = s.collectFiles(context.Background(), []string{"demo.go#Server.Handle", "demo.go:1-2", "demo.go:100-200"}, root)
+	testutils.AssertError(t, err)
+
+	files, manifest, err := s.collectFiles(context.Background(), []string{"demo.go#Server.Handle", "demo.go:18-99"}, root)
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 2, len(files))
+	testutils.AssertEqual(t, "// Handle handles.\nfunc (s *Server[T]) Handle() {\n\t_ = s.value\n}\n", string(files[0].Content))
+	testutils.AssertEqual(t, "Server.Handle", files[0].Symbol)
+	testutils.AssertEqual(t, filepath.Join(root, "demo.go"), manifest.Included[0].Path)
+	testutils.AssertEqual(t, "8-11", manifest.Included[0].Lines)
+	testutils.AssertEqual(t, "18-19", manifest.Included[1].Lines)
+}
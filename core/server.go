@@ -5,36 +5,100 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strings"
-	"time"
 
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/audit"
+	"github.com/anuramat/modagent/conversation"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
 type CallArgs struct {
-	Prompt       string
-	JsonOutput   bool
+	Prompt     string
+	JsonOutput bool
+	// JSONSchema constrains the reply; it implies JsonOutput.
+	JSONSchema   map[string]any
 	Conversation string
 	Filepaths    []string
 	Readonly     bool
 	BashCmd      string
-	Role         string
+	// BashCmds run after BashCmd, in order or, with BashParallel, all at
+	// once; BashStopOnFailure stops at the first one that fails.
+	BashCmds          []string
+	BashParallel      bool
+	BashStopOnFailure bool
+	// BashStdin is fed to every command; BashStdinPath names a file to feed
+	// instead.
+	BashStdin     string
+	BashStdinPath string
+	Role          string
+	Session       string
+	Cwd           string
+	Env           map[string]string
+	GitDiff       string
+	GitLog        int
+	GitBlame      []string
+	// Attachments are files passed to mods alongside the prompt; they come
+	// from filepaths rather than from the arguments.
+	Attachments []string
+	// Model overrides the model of the role; it's set for the models of a
+	// junior-panel rather than from the arguments.
+	Model string
 }
 
 type ServerConfig interface {
 	GetDefaultRole(readonly bool) string
 }
 
+// Options holds server-wide settings shared by all tools.
+type Options struct {
+	Exec     ExecPolicy
+	Roots    *Roots
+	Redactor *Redactor
+	// Conversations records turns; nil disables recording.
+	Conversations *conversation.Store
+	// IsolateClients scopes conversations to the MCP client session in
+	// addition to the project directory.
+	IsolateClients bool
+	Compaction     CompactionPolicy
+	Files          FilesPolicy
+	// Budgets limit the context per tool; tools without one are unlimited.
+	Budgets map[string]Budget
+	// ContextFormats frame the context per tool; the default is XML.
+	ContextFormats map[string]string
+	Attachments    AttachmentsPolicy
+	// Artifacts keeps the output of bash commands; nil uses
+	// artifacts.DefaultRoot.
+	Artifacts *artifacts.Store
+}
+
 type BaseServer struct {
-	config ServerConfig
+	config  ServerConfig
+	options Options
+}
+
+func NewBaseServer(config ServerConfig, options Options) *BaseServer {
+	return &BaseServer{config: config, options: options}
 }
 
-func NewBaseServer(config ServerConfig) *BaseServer {
-	return &BaseServer{config: config}
+// ExecPolicy returns the policy used to run bash commands.
+func (s *BaseServer) ExecPolicy() ExecPolicy {
+	return s.options.Exec
+}
+
+// ResolveCwd validates cwd against both the exec policy and the client roots.
+func (s *BaseServer) ResolveCwd(ctx context.Context, cwd string) (string, error) {
+	cwd, err := s.options.Exec.ResolveCwd(cwd)
+	if err != nil || cwd == "" {
+		return cwd, err
+	}
+	if err := s.options.Roots.Check(ctx, cwd); err != nil {
+		return "", fmt.Errorf("cwd rejected: %v", err)
+	}
+	return cwd, nil
 }
 
 func (s *BaseServer) HandleCall(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -46,6 +110,7 @@ func (s *BaseServer) HandleCallReadonly(ctx context.Context, request mcp.CallToo
 }
 
 func (s *BaseServer) handleCallWithReadonly(ctx context.Context, request mcp.CallToolRequest, readonly bool) (*mcp.CallToolResult, error) {
+	ctx = WithProgress(ctx, request)
 	params, err := ParseArgs(request.GetArguments())
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
@@ -53,22 +118,64 @@ func (s *BaseServer) handleCallWithReadonly(ctx context.Context, request mcp.Cal
 
 	params.Readonly = readonly
 
-	cmd := buildModsCmd(params, s.config.GetDefaultRole)
+	if params.Cwd, err = s.ResolveCwd(ctx, params.Cwd); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	stdin, tempDir, err := prepareStdin(params)
+	scope := s.Scope(ctx, params.Cwd)
+	state, err := s.resolveConversation(scope, params.Conversation, params.Session)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	stdin, report, err := s.prepareStdin(ctx, request.Params.Name, params, scope)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
+
+	modsParams := params
+	modsParams.Conversation = state.ModsID
+	modsParams.Attachments = report.Attachments
+	if params.JSONSchema != nil {
+		modsParams.Prompt += schemaPrompt(params.JSONSchema)
+	}
+
+	role := resolveRole(params, s.config.GetDefaultRole)
+	cmd := s.buildModsCmd(ctx, modsParams)
+	audit.FromContext(ctx).SetModel("mods", role)
+	injected := stdin.String()
+	if state.Stored != nil {
+		state.History, report.Compaction = s.compactHistory(ctx, state.Stored, params.Cwd, EstimateTokens(params.Prompt+injected))
+	}
+	if state.History != "" {
+		var replayed bytes.Buffer
+		replayed.WriteString(state.History)
+		replayed.Write(stdin.Bytes())
+		stdin = replayed
+	}
 	cmd.Stdin = &stdin
 
-	stdout, stderr, err := runCommand(cmd)
+	progress := ProgressFromContext(ctx)
+	progress.Report("waiting for model")
+	stream := progress.Stream()
+	stdout, stderr, err := runCommand(cmd, stream)
+	stream.Flush()
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("command failed: %v, stderr: %s", err, stderr)), nil
 	}
+	var jsonErrors []string
+	if params.JsonOutput {
+		stdout, jsonErrors = s.ensureJSON(ctx, request.Params.Name, modsParams, stdout)
+	}
 
-	conversationID := extractConversationID(stderr)
+	conversationID := s.recordTurn(request.Params.Name, state, params, role, injected, stdout)
+	audit.FromContext(ctx).SetConversation(conversationID)
 
-	result, err := buildResponse(stdout, conversationID, tempDir, params.JsonOutput)
+	if len(jsonErrors) > 0 {
+		// Keep the reply: the agent may still make use of it
+		return mcp.NewToolResultError(buildInvalidJSONResponse(stdout, conversationID, report, jsonErrors)), nil
+	}
+
+	result, err := buildResponse(stdout, conversationID, report, params.JsonOutput)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
@@ -76,98 +183,189 @@ func (s *BaseServer) handleCallWithReadonly(ctx context.Context, request mcp.Cal
 	return mcp.NewToolResultText(result), nil
 }
 
-func buildModsCmd(a CallArgs, getDefaultRole func(bool) string) *exec.Cmd {
+func buildModsCmd(ctx context.Context, a CallArgs, getDefaultRole func(bool) string, attachFlags ...string) *exec.Cmd {
 	cmdArgs := []string{}
 	if a.JsonOutput {
 		cmdArgs = append(cmdArgs, "-j")
 	}
 	if a.Conversation != "" {
 		cmdArgs = append(cmdArgs, "--continue="+a.Conversation)
-	}
-	if a.Role != "" {
-		cmdArgs = append(cmdArgs, "-R", a.Role)
 	} else {
-		cmdArgs = append(cmdArgs, "-R", getDefaultRole(a.Readonly))
+		// History is kept by modagent, mods doesn't need its own copy
+		cmdArgs = append(cmdArgs, "--no-cache")
 	}
+	cmdArgs = append(cmdArgs, "-R", resolveRole(a, getDefaultRole))
+	if a.Model != "" {
+		cmdArgs = append(cmdArgs, "-m", a.Model)
+	}
+	cmdArgs = append(cmdArgs, attachFlags...)
 	cmdArgs = append(cmdArgs, a.Prompt)
-	return exec.Command("mods", cmdArgs...)
+	cmd := exec.CommandContext(ctx, "mods", cmdArgs...)
+	cmd.Dir = a.Cwd
+	return cmd
+}
+
+func (s *BaseServer) buildModsCmd(ctx context.Context, a CallArgs) *exec.Cmd {
+	return buildModsCmd(ctx, a, s.config.GetDefaultRole, s.attachArgs(a.Attachments)...)
 }
 
-func prepareStdin(a CallArgs) (bytes.Buffer, string, error) {
+// contextReport describes what happened to the context while preparing stdin.
+type contextReport struct {
+	TempDir    string
+	Redactions int
+	Compaction *compactionReport
+	Files      *fileManifest
+	Budget     *budgetReport
+	// Attachments are the paths of the files to attach; they are listed in
+	// the files manifest too.
+	Attachments []string
+	// Artifacts are the files in TempDir, which clients can read as MCP
+	// resources.
+	Artifacts []artifacts.File
+}
+
+func (r contextReport) fields() map[string]any {
+	fields := map[string]any{}
+	if r.TempDir != "" {
+		fields["temp_dir"] = r.TempDir
+	}
+	if len(r.Artifacts) > 0 {
+		fields["artifacts"] = r.Artifacts
+	}
+	if r.Redactions > 0 {
+		fields["redactions"] = r.Redactions
+	}
+	if r.Compaction != nil {
+		fields["compaction"] = r.Compaction
+	}
+	if r.Files != nil {
+		fields["files"] = r.Files
+	}
+	if r.Budget != nil {
+		fields["budget"] = r.Budget
+	}
+	return fields
+}
+
+func resolveRole(a CallArgs, getDefaultRole func(bool) string) string {
+	if a.Role != "" {
+		return a.Role
+	}
+	return getDefaultRole(a.Readonly)
+}
+
+func (s *BaseServer) prepareStdin(ctx context.Context, tool string, a CallArgs, scope conversation.Scope) (bytes.Buffer, contextReport, error) {
 	var stdinBuffer bytes.Buffer
-	var tempDir string
-
-	if a.BashCmd != "" {
-		bashExec := exec.Command("bash", "-c", a.BashCmd)
-		var bashStdout, bashStderr bytes.Buffer
-		bashExec.Stdout = &bashStdout
-		bashExec.Stderr = &bashStderr
-
-		exitStatus := 0
-		if err := bashExec.Run(); err != nil {
-			if exitError, ok := err.(*exec.ExitError); ok {
-				exitStatus = exitError.ExitCode()
-			} else {
-				exitStatus = 1
-			}
-		}
+	var report contextReport
+	// Items are gathered in priority order, which is the order they are
+	// trimmed in when they don't fit the budget
+	var items []contextItem
 
-		// Create temp directory and save outputs
-		baseTmpDir := os.Getenv("TMPDIR")
-		if baseTmpDir == "" {
-			baseTmpDir = "/tmp"
+	if len(a.bashCommands()) > 0 {
+		bashItems, err := s.bashContext(ctx, a, scope, &report)
+		if err != nil {
+			return stdinBuffer, report, err
 		}
-		timestamp := time.Now().Format("20060102-150405-000000")
-		tempDir = filepath.Join(baseTmpDir, fmt.Sprintf("modagent-%s", timestamp))
+		items = append(items, bashItems...)
+	}
 
-		if err := os.MkdirAll(tempDir, 0o755); err != nil {
-			return stdinBuffer, "", fmt.Errorf("failed to create temp directory: %v", err)
-		}
+	gitItems, err := s.gitContext(ctx, a, &report)
+	if err != nil {
+		return stdinBuffer, report, err
+	}
+	items = append(items, gitItems...)
 
-		if err := os.WriteFile(filepath.Join(tempDir, "stdout"), bashStdout.Bytes(), 0o644); err != nil {
-			return stdinBuffer, "", fmt.Errorf("failed to write stdout file: %v", err)
+	if len(a.Filepaths) > 0 {
+		ProgressFromContext(ctx).Report(fmt.Sprintf("reading %d filepaths", len(a.Filepaths)))
+		files, manifest, err := s.collectFiles(ctx, a.Filepaths, a.Cwd)
+		if err != nil {
+			return stdinBuffer, report, err
 		}
-		if err := os.WriteFile(filepath.Join(tempDir, "stderr"), bashStderr.Bytes(), 0o644); err != nil {
-			return stdinBuffer, "", fmt.Errorf("failed to write stderr file: %v", err)
+		report.Files = manifest
+		for _, file := range files {
+			if file.MediaType != "" {
+				// The model gets the file itself; the item tells it which
+				// attachment is which
+				report.Attachments = append(report.Attachments, file.Path)
+				items = append(items, contextItem{
+					Kind:  "attachment",
+					Attrs: []attr{{Name: "path", Value: file.Path}, {Name: "media_type", Value: file.MediaType}},
+				})
+				continue
+			}
+			attrs := []attr{{Name: "path", Value: file.Path}}
+			if file.Start > 0 {
+				attrs = append(attrs, attr{Name: "lines", Value: fmt.Sprintf("%d-%d", file.Start, file.End)})
+			}
+			if file.Symbol != "" {
+				attrs = append(attrs, attr{Name: "symbol", Value: file.Symbol})
+			}
+			if file.ExtractedFrom != "" {
+				attrs = append(attrs, attr{Name: "extracted_from", Value: file.ExtractedFrom})
+			}
+			items = append(items, contextItem{
+				Kind:     "file",
+				Attrs:    attrs,
+				Sections: []section{{Text: s.redact(string(file.Content), &report)}},
+			})
 		}
-
-		stdinBuffer.WriteString(fmt.Sprintf("<bash command=\"%s\" exit_status=\"%d\"><stdout>%s</stdout><stderr>%s</stderr></bash>\n", a.BashCmd, exitStatus, bashStdout.String(), bashStderr.String()))
 	}
 
-	for _, filepath := range a.Filepaths {
-		content, err := os.ReadFile(filepath)
-		if err != nil {
-			return stdinBuffer, tempDir, fmt.Errorf("failed to read file %s: %v", filepath, err)
+	format := s.contextFormat(tool)
+	items, report.Budget = s.budgetFor(tool).fit(items, a.Prompt, format)
+	stdinBuffer.WriteString(encodeItems(format, items))
+	return stdinBuffer, report, nil
+}
+
+// ReadBashStdin returns the input for bash_cmd: the bash_stdin text, or the
+// content of the bash_stdin file, which is resolved against cwd and must be
+// within the client roots. Both are subject to the exec policy's size limit.
+func (s *BaseServer) ReadBashStdin(ctx context.Context, a CallArgs) (string, error) {
+	limit := s.options.Exec.MaxStdin
+	if a.BashStdinPath == "" {
+		if limit > 0 && int64(len(a.BashStdin)) > limit {
+			return "", fmt.Errorf("bash_stdin is %d bytes, more than the limit of %d", len(a.BashStdin), limit)
 		}
-		stdinBuffer.WriteString(fmt.Sprintf("<file path=%s>\n%s</file path=%s>\n", filepath, string(content), filepath))
+		return a.BashStdin, nil
 	}
 
-	return stdinBuffer, tempDir, nil
+	path := a.BashStdinPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(a.Cwd, path)
+	}
+	if err := s.options.Roots.Check(ctx, path); err != nil {
+		return "", fmt.Errorf("bash_stdin rejected: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bash_stdin %s: %v", path, err)
+	}
+	if limit > 0 && info.Size() > limit {
+		return "", fmt.Errorf("bash_stdin %s is %d bytes, more than the limit of %d", path, info.Size(), limit)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bash_stdin %s: %v", path, err)
+	}
+	return string(content), nil
 }
 
-func runCommand(cmd *exec.Cmd) (string, string, error) {
+func (s *BaseServer) redact(text string, report *contextReport) string {
+	text, n := s.options.Redactor.Redact(text)
+	report.Redactions += n
+	return text
+}
+
+// runCommand runs cmd and returns its output, which is also copied to the
+// extra writers as it's produced.
+func runCommand(cmd *exec.Cmd, extra ...io.Writer) (string, string, error) {
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
+	cmd.Stdout = io.MultiWriter(append([]io.Writer{&stdout}, extra...)...)
 	cmd.Stderr = &stderr
 	err := cmd.Run()
 	return stdout.String(), stderr.String(), err
 }
 
-func extractConversationID(stderrOutput string) string {
-	conversationID := ""
-	if lines := strings.Split(stderrOutput, "\n"); len(lines) > 0 {
-		lastLine := lines[len(lines)-1]
-		if lastLine == "" && len(lines) > 1 {
-			lastLine = lines[len(lines)-2]
-		}
-		re := regexp.MustCompile(`Conversation saved:\s+(\w+)`)
-		if matches := re.FindStringSubmatch(lastLine); len(matches) > 1 {
-			conversationID = matches[1]
-		}
-	}
-	return conversationID
-}
-
 func ParseArgs(args map[string]any) (CallArgs, error) {
 	var a CallArgs
 
@@ -180,6 +378,23 @@ func ParseArgs(args map[string]any) (CallArgs, error) {
 	if val, ok := args["json_output"].(bool); ok {
 		a.JsonOutput = val
 	}
+	if val, exists := args["json_schema"]; exists {
+		// Some clients send objects as JSON text
+		if text, ok := val.(string); ok {
+			if err := json.Unmarshal([]byte(text), &val); err != nil {
+				return a, fmt.Errorf("json_schema must be a JSON Schema object: %v", err)
+			}
+		}
+		schema, ok := val.(map[string]any)
+		if !ok {
+			return a, fmt.Errorf("json_schema must be a JSON Schema object")
+		}
+		if err := checkSchema(schema, "$"); err != nil {
+			return a, err
+		}
+		a.JSONSchema = schema
+		a.JsonOutput = true
+	}
 	if val, ok := args["conversation"].(string); ok {
 		a.Conversation = val
 	}
@@ -198,21 +413,100 @@ func ParseArgs(args map[string]any) (CallArgs, error) {
 	if val, ok := args["bash_cmd"].(string); ok {
 		a.BashCmd = val
 	}
+	if val, exists := args["bash_cmds"]; exists {
+		commands, ok := val.([]any)
+		if !ok {
+			return a, fmt.Errorf("bash_cmds must be an array of strings")
+		}
+		for _, c := range commands {
+			command, ok := c.(string)
+			if !ok || command == "" {
+				return a, fmt.Errorf("bash_cmds must be an array of non-empty strings")
+			}
+			a.BashCmds = append(a.BashCmds, command)
+		}
+	}
+	if val, ok := args["bash_parallel"].(bool); ok {
+		a.BashParallel = val
+	}
+	if val, ok := args["bash_stop_on_failure"].(bool); ok {
+		a.BashStopOnFailure = val
+	}
+	if val, exists := args["bash_stdin"]; exists {
+		switch val := val.(type) {
+		case string:
+			a.BashStdin = val
+		case map[string]any:
+			path, ok := val["path"].(string)
+			if !ok || path == "" {
+				return a, fmt.Errorf("bash_stdin object must have a path")
+			}
+			a.BashStdinPath = path
+		default:
+			return a, fmt.Errorf("bash_stdin must be a string or an object with a path")
+		}
+	}
 	if val, ok := args["role"].(string); ok {
 		a.Role = val
 	}
+	if val, ok := args["session"].(string); ok {
+		a.Session = val
+	}
+	if val, ok := args["cwd"].(string); ok {
+		a.Cwd = val
+	}
+	if val, ok := args["git_diff"].(string); ok {
+		a.GitDiff = val
+	}
+	if val, ok := args["git_log"].(float64); ok {
+		if val < 0 {
+			return a, fmt.Errorf("git_log must not be negative")
+		}
+		a.GitLog = int(val)
+	}
+	if val, exists := args["git_blame"]; exists {
+		paths, ok := val.([]any)
+		if !ok {
+			return a, fmt.Errorf("git_blame must be an array of strings")
+		}
+		for _, p := range paths {
+			if s, ok := p.(string); ok {
+				a.GitBlame = append(a.GitBlame, s)
+			}
+		}
+	}
+	if val, exists := args["env"]; exists {
+		vars, ok := val.(map[string]any)
+		if !ok {
+			return a, fmt.Errorf("env must be an object of strings")
+		}
+		a.Env = make(map[string]string, len(vars))
+		for name, v := range vars {
+			s, ok := v.(string)
+			if !ok {
+				return a, fmt.Errorf("env variable %s must be a string", name)
+			}
+			a.Env[name] = s
+		}
+	}
 	return a, nil
 }
 
-func buildResponse(output, conversationID, tempDir string, jsonOutput bool) (string, error) {
-	responseObj := map[string]any{
-		"response":     output,
-		"conversation": conversationID,
-	}
+// buildInvalidJSONResponse returns the raw reply of a json_output call that
+// stayed invalid after the repairs, along with the reasons.
+func buildInvalidJSONResponse(output, conversationID string, report contextReport, errs []string) string {
+	responseObj := report.fields()
+	responseObj["response"] = output
+	responseObj["conversation"] = conversationID
+	responseObj["validation_errors"] = errs
+	jsonBytes, _ := json.Marshal(responseObj)
+	return string(jsonBytes)
+}
 
-	if tempDir != "" {
-		responseObj["temp_dir"] = tempDir
-	}
+func buildResponse(output, conversationID string, report contextReport, jsonOutput bool) (string, error) {
+	responseObj := report.fields()
+	responseObj["response"] = output
+	responseObj["conversation"] = conversationID
 
 	if jsonOutput {
 		var result any
@@ -19,6 +19,42 @@ func TestParseArgsSimple(t *testing.T) {
 			},
 			WantErr: false,
 		},
+		{
+			Name:     "negative git_log",
+			Input:    map[string]any{"prompt": "review", "git_log": float64(-1)},
+			Expected: CallArgs{},
+			WantErr:  true,
+		},
+		{
+			Name:     "bash_stdin of the wrong type",
+			Input:    map[string]any{"prompt": "sort", "bash_stdin": float64(1)},
+			Expected: CallArgs{},
+			WantErr:  true,
+		},
+		{
+			Name:     "bash_stdin object without path",
+			Input:    map[string]any{"prompt": "sort", "bash_stdin": map[string]any{}},
+			Expected: CallArgs{},
+			WantErr:  true,
+		},
+		{
+			Name:     "bash_cmds with an empty command",
+			Input:    map[string]any{"prompt": "check", "bash_cmds": []any{"go vet ./...", ""}},
+			Expected: CallArgs{},
+			WantErr:  true,
+		},
+		{
+			Name:     "json_schema with $ref",
+			Input:    map[string]any{"prompt": "list", "json_schema": map[string]any{"items": map[string]any{"$ref": "#/defs/x"}}},
+			Expected: CallArgs{},
+			WantErr:  true,
+		},
+		{
+			Name:     "json_schema that isn't an object",
+			Input:    map[string]any{"prompt": "list", "json_schema": "[1]"},
+			Expected: CallArgs{},
+			WantErr:  true,
+		},
 		{
 			Name:     "missing prompt",
 			Input:    map[string]any{},
@@ -63,34 +99,9 @@ func TestBuildResponseSimple(t *testing.T) {
 			jsonOutput     bool
 		})
 
-		result, err := buildResponse(input.output, input.conversationID, input.tempDir, input.jsonOutput)
+		result, err := buildResponse(input.output, input.conversationID, contextReport{TempDir: input.tempDir}, input.jsonOutput)
 
 		testutils.AssertNoError(t, err)
 		testutils.AssertJSONEqual(t, tt.Expected.(string), result)
 	})
 }
-
-func TestExtractConversationIDSimple(t *testing.T) {
-	tests := []testutils.TableTest{
-		{
-			Name:     "valid conversation line",
-			Input:    "Some output\nConversation saved: abc123\n",
-			Expected: "abc123",
-		},
-		{
-			Name:     "no conversation line",
-			Input:    "Some output\nNo conversation here",
-			Expected: "",
-		},
-		{
-			Name:     "empty input",
-			Input:    "",
-			Expected: "",
-		},
-	}
-
-	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
-		result := extractConversationID(tt.Input.(string))
-		testutils.AssertEqual(t, tt.Expected, result)
-	})
-}
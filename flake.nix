@@ -22,7 +22,7 @@
           pname = "modagent";
           version = "unstable";
           src = ./.;
-          vendorHash = "sha256-4AePrpLGGCWMTem6/7cqzyPWCmUvpEcWGA1MimFkx6o=";
+          vendorHash = "sha256-MQE3udyqm++eI/Vh5nq01cIyEeW3YmGJyOdfR/ONZ+c=";
           meta.mainProgram = "modagent";
         };
 
@@ -0,0 +1,229 @@
+// Package framing frames context for the model in XML, Markdown or JSON,
+// escaping it so that no content can break out of its item.
+package framing
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats: how items are framed for the model.
+const (
+	XML      = "xml"
+	Markdown = "markdown"
+	JSON     = "json"
+)
+
+type encoder func(b *strings.Builder, item Item)
+
+var encoders = map[string]encoder{
+	XML:      encodeXML,
+	Markdown: encodeMarkdown,
+	JSON:     encodeJSON,
+}
+
+// Validate returns an error for unknown formats.
+func Validate(format string) error {
+	if _, ok := encoders[format]; !ok {
+		names := make([]string, 0, len(encoders))
+		for name := range encoders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown context format %q (valid: %s)", format, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Item is a piece of context for the model, such as a file or the output
+// of a command, before it is framed.
+type Item struct {
+	// Kind is the tag of the item, e.g. file or bash.
+	Kind  string
+	Attrs []Attr
+	// Sections hold the text; commands have stdout and stderr, everything
+	// else a single unnamed section.
+	Sections []Section
+}
+
+type Attr struct {
+	Name, Value string
+}
+
+type Section struct {
+	Name string
+	Text string
+	// KeepTail trims from the start instead of the end, which keeps the end
+	// of command output where errors usually are.
+	KeepTail bool
+	// Framed text was encoded as items already, such as the stored context
+	// of a conversation turn; XML inserts it without escaping it again.
+	Framed bool
+}
+
+// Label names the item in reports, e.g. "file /src/main.go".
+func (item Item) Label() string {
+	if len(item.Attrs) == 0 {
+		return item.Kind
+	}
+	return item.Kind + " " + item.Attrs[0].Value
+}
+
+// Encode frames items in the given format; unknown formats fall back to
+// XML. Whatever the content, it can't break out of its item.
+func Encode(format string, items []Item) string {
+	encode, ok := encoders[format]
+	if !ok {
+		encode = encodeXML
+	}
+	var b strings.Builder
+	for _, item := range items {
+		encode(&b, item)
+	}
+	return b.String()
+}
+
+// encodeXML writes an element per item, with attributes and text escaped.
+// Unnamed sections are the element's text, named ones child elements.
+func encodeXML(b *strings.Builder, item Item) {
+	b.WriteString("<" + item.Kind)
+	for _, a := range item.Attrs {
+		fmt.Fprintf(b, " %s=\"%s\"", a.Name, escapeXML(a.Value, true))
+	}
+	b.WriteString(">")
+	for _, sec := range item.Sections {
+		text := sec.Text
+		if !sec.Framed {
+			text = escapeXML(text, false)
+		}
+		if sec.Name == "" {
+			b.WriteString("\n" + text)
+			continue
+		}
+		fmt.Fprintf(b, "<%s>%s</%s>", sec.Name, text, sec.Name)
+	}
+	b.WriteString("</" + item.Kind + ">\n")
+}
+
+// escapeXML escapes markup characters, plus quotes and line breaks in
+// attributes, and replaces characters XML can't represent.
+func escapeXML(text string, attribute bool) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case attribute && r == '"':
+			b.WriteString("&quot;")
+		case attribute && r == '\n':
+			b.WriteString("&#xA;")
+		case attribute && r == '\r':
+			b.WriteString("&#xD;")
+		case attribute && r == '\t':
+			b.WriteString("&#x9;")
+		case !isXMLChar(r):
+			b.WriteRune(utf8.RuneError)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+// encodeMarkdown writes a heading per item, attributes as a list and
+// sections as code fences that are longer than any backtick run in their
+// content.
+func encodeMarkdown(b *strings.Builder, item Item) {
+	fmt.Fprintf(b, "### %s\n\n", item.Kind)
+	for _, a := range item.Attrs {
+		if strings.Contains(a.Value, "\n") {
+			fmt.Fprintf(b, "- %s:\n\n", a.Name)
+			writeFence(b, a.Value)
+			continue
+		}
+		fmt.Fprintf(b, "- %s: %s\n", a.Name, inlineCode(a.Value))
+	}
+	if len(item.Attrs) > 0 {
+		b.WriteString("\n")
+	}
+	for _, sec := range item.Sections {
+		if sec.Name != "" {
+			fmt.Fprintf(b, "%s:\n\n", sec.Name)
+		}
+		writeFence(b, sec.Text)
+	}
+}
+
+func writeFence(b *strings.Builder, text string) {
+	fence := Fence(text)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	fmt.Fprintf(b, "%s\n%s%s\n\n", fence, text, fence)
+}
+
+// inlineCode wraps text in enough backticks that it can't close early,
+// padding with spaces where the text starts or ends with a backtick.
+func inlineCode(text string) string {
+	ticks := strings.Repeat("`", longestRun(text, '`')+1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return ticks + text + ticks
+}
+
+// Fence returns a Markdown code fence longer than any backtick run in
+// text, so that the content can't close it early.
+func Fence(text string) string {
+	return strings.Repeat("`", max(3, longestRun(text, '`')+1))
+}
+
+func longestRun(text string, r rune) int {
+	longest, current := 0, 0
+	for _, c := range text {
+		if c != r {
+			current = 0
+			continue
+		}
+		current++
+		longest = max(longest, current)
+	}
+	return longest
+}
+
+// encodeJSON writes a JSON object per line, with the kind under "type",
+// attributes and named sections as fields, and an unnamed section as
+// "content".
+func encodeJSON(b *strings.Builder, item Item) {
+	fields := map[string]string{"type": item.Kind}
+	for _, a := range item.Attrs {
+		fields[a.Name] = a.Value
+	}
+	for _, sec := range item.Sections {
+		name := sec.Name
+		if name == "" {
+			name = "content"
+		}
+		fields[name] = sec.Text
+	}
+	var line strings.Builder
+	encoder := json.NewEncoder(&line)
+	// The model reads this; "<" is not a problem here
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(fields)
+	b.WriteString(line.String())
+}
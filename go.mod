@@ -1,10 +1,10 @@
 module github.com/anuramat/modagent
 
-go 1.23
+go 1.23.0
 
 require (
 	github.com/adrg/xdg v0.5.3
-	github.com/mark3labs/mcp-go v0.37.0
+	github.com/mark3labs/mcp-go v0.43.2
 	gopkg.in/yaml.v3 v3.0.1
 )
 
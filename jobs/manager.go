@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anuramat/modagent/audit"
+	"github.com/anuramat/modagent/core"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultRetention is how long finished jobs are kept.
+const DefaultRetention = 7 * 24 * time.Hour
+
+// AcquireFunc waits for a slot to run a tool, like limits.Limiter.Acquire.
+type AcquireFunc func(ctx context.Context, tool string) (func(), error)
+
+// ProjectFunc resolves the project directory of a call from its context and
+// optional working directory, rejecting directories the call may not access.
+type ProjectFunc func(ctx context.Context, cwd string) (string, error)
+
+// Manager runs tool calls in the background and records them in the store.
+type Manager struct {
+	// Audit, if set, records each job as a call of its own once it
+	// finishes; the entry of the call that started it is written before
+	// the job does anything.
+	Audit *audit.Logger
+
+	store   *Store
+	acquire AcquireFunc
+	project ProjectFunc
+
+	mu      sync.Mutex
+	running map[string]*run
+}
+
+type run struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewManager returns a manager; acquire may be nil when calls are not
+// limited.
+func NewManager(store *Store, project ProjectFunc, acquire AcquireFunc) *Manager {
+	return &Manager{store: store, project: project, acquire: acquire, running: make(map[string]*run)}
+}
+
+// Async wraps a tool handler so that calls with "async": true start a job
+// and return its ID immediately.
+func (m *Manager) Async(handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !request.GetBool("async", false) {
+			return handler(ctx, request)
+		}
+		j, err := m.Start(ctx, request, handler)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return jsonResult(status(j))
+	}
+}
+
+// Start runs the call in the background. The job keeps the values of ctx,
+// such as the client session, but not its cancellation or progress
+// reporting, which end with the request. The returned job is a snapshot
+// as started; the store has its later states.
+func (m *Manager) Start(ctx context.Context, request mcp.CallToolRequest, handler server.ToolHandlerFunc) (*Job, error) {
+	project, err := m.project(ctx, request.GetString("cwd", ""))
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{
+		ID:      NewID(),
+		Tool:    request.Params.Name,
+		Project: project,
+		Prompt:  strings.TrimSpace(request.GetString("prompt", "")),
+		Status:  StatusRunning,
+		PID:     os.Getpid(),
+		Created: time.Now().UTC(),
+	}
+	if err := m.store.Save(j); err != nil {
+		return nil, fmt.Errorf("failed to save job: %w", err)
+	}
+	audit.FromContext(ctx).SetJob(j.ID)
+
+	request.Params.Meta = nil
+	jobCtx, cancel := context.WithCancel(core.WithoutProgress(context.WithoutCancel(ctx)))
+	r := &run{cancel: cancel, done: make(chan struct{})}
+	m.mu.Lock()
+	m.running[j.ID] = r
+	m.mu.Unlock()
+
+	// The goroutine updates its own copy, so the caller can read j
+	running := *j
+	go func() {
+		defer close(r.done)
+		defer cancel()
+		result, err := m.call(jobCtx, running.ID, request, handler)
+		m.finish(&running, jobCtx, result, err)
+	}()
+	return j, nil
+}
+
+func (m *Manager) call(ctx context.Context, id string, request mcp.CallToolRequest, handler server.ToolHandlerFunc) (*mcp.CallToolResult, error) {
+	if m.acquire != nil {
+		release, err := m.acquire(ctx, request.Params.Name)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	if m.Audit != nil {
+		// The audit entry of ctx is already written; the middleware gives
+		// the job a fresh one
+		return m.Audit.Middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			audit.FromContext(ctx).SetJob(id)
+			return handler(ctx, request)
+		})(ctx, request)
+	}
+	return handler(ctx, request)
+}
+
+func (m *Manager) finish(j *Job, ctx context.Context, result *mcp.CallToolResult, err error) {
+	m.mu.Lock()
+	delete(m.running, j.ID)
+	m.mu.Unlock()
+
+	now := time.Now().UTC()
+	j.Finished = &now
+	switch {
+	case ctx.Err() != nil:
+		j.Status = StatusCancelled
+	case err != nil:
+		j.Status, j.Result, j.IsError = StatusFailed, err.Error(), true
+	default:
+		j.Result, j.IsError = resultText(result), result.IsError
+		j.Status = StatusSucceeded
+		if result.IsError {
+			j.Status = StatusFailed
+		}
+	}
+	if err := m.store.Save(j); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save job %s: %v\n", j.ID, err)
+	}
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Cancel stops a running job.
+func (m *Manager) Cancel(id string) (*Job, error) {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	m.mu.Unlock()
+	if !ok {
+		j, err := m.store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if !j.Done() {
+			return nil, fmt.Errorf("job %s is running in another modagent process (pid %d)", id, j.PID)
+		}
+		return j, nil
+	}
+	r.cancel()
+	<-r.done
+	return m.store.Get(id)
+}
+
+// Wait returns the job once it's done or the timeout expires, whichever is
+// first.
+func (m *Manager) Wait(ctx context.Context, id string, timeout time.Duration) (*Job, error) {
+	m.mu.Lock()
+	r, ok := m.running[id]
+	m.mu.Unlock()
+	if ok && timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-r.done:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return m.store.Get(id)
+}
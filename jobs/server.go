@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultListLimit = 20
+	// maxWait bounds how long job_result blocks, keeping clients clear of
+	// their request timeouts.
+	maxWait = 10 * time.Minute
+)
+
+const (
+	StatusDescription = "Check the status of a job started with \"async\": true"
+	ResultDescription = "Get the result of a job started with \"async\": true, optionally waiting for it to finish; the result is returned as if the tool had been called synchronously"
+	CancelDescription = "Cancel a running job started with \"async\": true"
+	ListDescription   = "List the jobs of the current project, most recent first"
+)
+
+// summary is a job without its result.
+type summary struct {
+	ID       string     `json:"job"`
+	Tool     string     `json:"tool"`
+	Status   string     `json:"status"`
+	Prompt   string     `json:"prompt,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+func status(j *Job) summary {
+	return summary{ID: j.ID, Tool: j.Tool, Status: j.Status, Prompt: j.Prompt, Created: j.Created, Finished: j.Finished}
+}
+
+func jsonResult(v any) (*mcp.CallToolResult, error) {
+	jsonBytes, _ := json.Marshal(v)
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// get returns the job if it belongs to the project of the call.
+func (m *Manager) get(ctx context.Context, request mcp.CallToolRequest) (*Job, error) {
+	id, err := request.RequireString("id")
+	if err != nil {
+		return nil, err
+	}
+	project, err := m.project(ctx, request.GetString("cwd", ""))
+	if err != nil {
+		return nil, err
+	}
+	j, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Project != "" && j.Project != project {
+		return nil, ErrNotFound
+	}
+	return j, nil
+}
+
+func (m *Manager) HandleStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	j, err := m.get(ctx, request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonResult(status(j))
+}
+
+func (m *Manager) HandleResult(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	j, err := m.get(ctx, request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	wait := time.Duration(request.GetFloat("wait", 0) * float64(time.Second))
+	if j, err = m.Wait(ctx, j.ID, min(wait, maxWait)); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	switch j.Status {
+	case StatusSucceeded, StatusFailed:
+		return &mcp.CallToolResult{Content: []mcp.Content{mcp.NewTextContent(j.Result)}, IsError: j.IsError}, nil
+	case StatusRunning:
+		return jsonResult(status(j))
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("job %s was %s", j.ID, j.Status)), nil
+	}
+}
+
+func (m *Manager) HandleCancel(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	j, err := m.get(ctx, request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if j, err = m.Cancel(j.ID); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return jsonResult(status(j))
+}
+
+func (m *Manager) HandleList(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	project, err := m.project(ctx, request.GetString("cwd", ""))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	all, err := m.store.List(project, 0)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	filter := request.GetString("status", "")
+	limit := request.GetInt("limit", defaultListLimit)
+	summaries := []summary{}
+	for _, j := range all {
+		if filter != "" && j.Status != filter {
+			continue
+		}
+		if limit > 0 && len(summaries) == limit {
+			break
+		}
+		summaries = append(summaries, status(j))
+	}
+	return jsonResult(map[string]any{"jobs": summaries})
+}
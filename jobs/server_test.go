@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anuramat/modagent/audit"
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	return NewManager(newTestStore(t), func(context.Context, string) (string, error) { return "/src/a", nil }, nil)
+}
+
+func call(t *testing.T, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), tool string, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	result, err := handler(context.Background(), testutils.CreateMCPRequest(tool, args))
+	testutils.AssertNoError(t, err)
+	return result
+}
+
+func text(result *mcp.CallToolResult) string {
+	return result.Content[0].(mcp.TextContent).Text
+}
+
+func startJob(t *testing.T, m *Manager, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)) string {
+	t.Helper()
+	result := call(t, m.Async(handler), "junior-rwx", map[string]any{"prompt": "do it", "async": true})
+	testutils.AssertEqual(t, false, result.IsError)
+	var started summary
+	testutils.AssertNoError(t, json.Unmarshal([]byte(text(result)), &started))
+	testutils.AssertEqual(t, StatusRunning, started.Status)
+	return started.ID
+}
+
+func TestAsyncResult(t *testing.T) {
+	m := newTestManager(t)
+	release := make(chan struct{})
+	id := startJob(t, m, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		<-release
+		return mcp.NewToolResultText("done"), nil
+	})
+
+	result := call(t, m.HandleResult, "job_result", map[string]any{"id": id})
+	testutils.AssertContains(t, text(result), `"status":"running"`)
+
+	close(release)
+	result = call(t, m.HandleResult, "job_result", map[string]any{"id": id, "wait": float64(5)})
+	testutils.AssertEqual(t, false, result.IsError)
+	testutils.AssertEqual(t, "done", text(result))
+
+	result = call(t, m.HandleList, "job_list", map[string]any{"status": StatusSucceeded})
+	testutils.AssertContains(t, text(result), id)
+	testutils.AssertContains(t, text(result), `"prompt":"do it"`)
+}
+
+func TestAsyncReplyIsStartedSnapshot(t *testing.T) {
+	m := newTestManager(t)
+	for range 20 {
+		// startJob checks that the reply shows the job as running, however
+		// quickly it finishes
+		id := startJob(t, m, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("done"), nil
+		})
+		result := call(t, m.HandleResult, "job_result", map[string]any{"id": id, "wait": float64(5)})
+		testutils.AssertEqual(t, "done", text(result))
+	}
+}
+
+func TestAsyncToolError(t *testing.T) {
+	m := newTestManager(t)
+	id := startJob(t, m, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultError("command failed"), nil
+	})
+
+	result := call(t, m.HandleResult, "job_result", map[string]any{"id": id, "wait": float64(5)})
+	testutils.AssertEqual(t, true, result.IsError)
+	testutils.AssertEqual(t, "command failed", text(result))
+
+	result = call(t, m.HandleStatus, "job_status", map[string]any{"id": id})
+	testutils.AssertContains(t, text(result), `"status":"failed"`)
+}
+
+func TestAsyncCancel(t *testing.T) {
+	m := newTestManager(t)
+	id := startJob(t, m, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		<-ctx.Done()
+		return mcp.NewToolResultError(ctx.Err().Error()), nil
+	})
+
+	result := call(t, m.HandleCancel, "job_cancel", map[string]any{"id": id})
+	testutils.AssertContains(t, text(result), `"status":"cancelled"`)
+
+	result = call(t, m.HandleResult, "job_result", map[string]any{"id": id})
+	testutils.AssertEqual(t, true, result.IsError)
+}
+
+func TestAsyncAudited(t *testing.T) {
+	m := newTestManager(t)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger, err := audit.NewLogger(audit.Settings{Path: path})
+	testutils.AssertNoError(t, err)
+	m.Audit = logger
+	handler := logger.Middleware(m.Async(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		audit.FromContext(ctx).SetExec("make test", 0)
+		return mcp.NewToolResultText("done"), nil
+	}))
+	result := call(t, handler, "junior-rwx", map[string]any{"prompt": "do it", "async": true})
+	var j summary
+	testutils.AssertNoError(t, json.Unmarshal([]byte(text(result)), &j))
+	id := j.ID
+	call(t, m.HandleResult, "job_result", map[string]any{"id": id, "wait": float64(5)})
+
+	data, err := os.ReadFile(path)
+	testutils.AssertNoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	testutils.AssertEqual(t, 2, len(lines))
+	var started, finished audit.Entry
+	testutils.AssertNoError(t, json.Unmarshal([]byte(lines[0]), &started))
+	testutils.AssertNoError(t, json.Unmarshal([]byte(lines[1]), &finished))
+	testutils.AssertEqual(t, id, started.Job)
+	testutils.AssertEqual(t, "", started.BashCmd)
+	testutils.AssertEqual(t, id, finished.Job)
+	testutils.AssertEqual(t, "make test", finished.BashCmd)
+}
+
+func TestSyncCallsPassThrough(t *testing.T) {
+	m := newTestManager(t)
+	handler := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("sync"), nil
+	}
+	result := call(t, m.Async(handler), "junior-r", map[string]any{"prompt": "q"})
+	testutils.AssertEqual(t, "sync", text(result))
+}
+
+func TestJobsOfOtherProjects(t *testing.T) {
+	m := newTestManager(t)
+	testutils.AssertNoError(t, m.store.Save(&Job{ID: "theirs", Project: "/src/b", Status: StatusSucceeded}))
+
+	for _, tool := range []string{"job_status", "job_result", "job_cancel"} {
+		handler := map[string]func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+			"job_status": m.HandleStatus,
+			"job_result": m.HandleResult,
+			"job_cancel": m.HandleCancel,
+		}[tool]
+		result := call(t, handler, tool, map[string]any{"id": "theirs"})
+		testutils.AssertEqual(t, true, result.IsError)
+	}
+
+	result := call(t, m.HandleList, "job_list", map[string]any{})
+	testutils.AssertEqual(t, `{"jobs":[]}`, text(result))
+}
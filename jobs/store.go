@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrNotFound = errors.New("job not found")
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Job statuses; every status but StatusRunning is final.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	// StatusInterrupted marks jobs whose modagent process exited before
+	// they finished.
+	StatusInterrupted = "interrupted"
+)
+
+// Job is a tool call running in the background.
+type Job struct {
+	ID      string `json:"id"`
+	Tool    string `json:"tool"`
+	Project string `json:"project,omitempty"`
+	Prompt  string `json:"prompt,omitempty"`
+	Status  string `json:"status"`
+	// PID is the modagent process running the job.
+	PID      int        `json:"pid"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Result is the text of the tool result, IsError whether the tool
+	// reported an error.
+	Result  string `json:"result,omitempty"`
+	IsError bool   `json:"is_error,omitempty"`
+}
+
+func (j *Job) Done() bool {
+	return j.Status != StatusRunning
+}
+
+// Store keeps jobs as JSON files, one per job, so that they outlive client
+// connections.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create job store: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// NewID returns a random job ID.
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Store) path(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", fmt.Errorf("invalid job ID: %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *Store) Get(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(id)
+}
+
+func (s *Store) get(id string) (*Job, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var j Job
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("corrupt job %s: %w", id, err)
+	}
+	if j.Status == StatusRunning && !processAlive(j.PID) {
+		j.Status = StatusInterrupted
+	}
+	return &j, nil
+}
+
+// processAlive reports whether the process running a job still exists.
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func (s *Store) Save(j *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(j.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write atomically so readers never observe a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// List returns the jobs of a project, newest first; an empty project
+// matches every job. limit <= 0 returns all of them.
+func (s *Store) List(project string, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		j, err := s.get(id)
+		if err != nil {
+			continue
+		}
+		if project == "" || j.Project == "" || j.Project == project {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].Created.After(jobs[k].Created) })
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+// Prune deletes finished jobs older than maxAge.
+func (s *Store) Prune(maxAge time.Duration) error {
+	jobs, err := s.List("", 0)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range jobs {
+		if !j.Done() || time.Since(j.Created) <= maxAge {
+			continue
+		}
+		path, _ := s.path(j.ID)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
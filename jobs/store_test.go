@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anuramat/modagent/testutils"
+)
+
+func newTestStore(t *testing.T) *Store {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-jobs-*")
+	testutils.AssertNoError(t, err)
+	t.Cleanup(cleanup)
+	store, err := NewStore(dir)
+	testutils.AssertNoError(t, err)
+	return store
+}
+
+func TestStoreInterrupted(t *testing.T) {
+	store := newTestStore(t)
+	// PIDs are far below this on every supported system
+	testutils.AssertNoError(t, store.Save(&Job{ID: "gone", Status: StatusRunning, PID: 1 << 30}))
+
+	j, err := store.Get("gone")
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, StatusInterrupted, j.Status)
+
+	_, err = store.Get("../gone")
+	testutils.AssertError(t, err)
+	_, err = store.Get("missing")
+	testutils.AssertEqual(t, ErrNotFound, err)
+}
+
+func TestStoreListAndPrune(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now()
+	jobs := []*Job{
+		{ID: "old", Project: "/src/a", Status: StatusSucceeded, Created: now.Add(-30 * 24 * time.Hour)},
+		{ID: "new", Project: "/src/a", Status: StatusSucceeded, Created: now},
+		{ID: "other", Project: "/src/b", Status: StatusSucceeded, Created: now},
+	}
+	for _, j := range jobs {
+		testutils.AssertNoError(t, store.Save(j))
+	}
+
+	list, err := store.List("/src/a", 0)
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 2, len(list))
+	testutils.AssertEqual(t, "new", list[0].ID)
+
+	list, err = store.List("", 1)
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, 1, len(list))
+
+	testutils.AssertNoError(t, store.Prune(DefaultRetention))
+	_, err = store.Get("old")
+	testutils.AssertEqual(t, ErrNotFound, err)
+	_, err = store.Get("new")
+	testutils.AssertNoError(t, err)
+}
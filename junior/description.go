@@ -4,3 +4,6 @@ import _ "embed"
 
 //go:embed description.md
 var Description string
+
+//go:embed panel.md
+var PanelDescription string
@@ -8,10 +8,10 @@ type Server struct {
 
 type Config struct{}
 
-func New() *Server {
+func New(options core.Options) *Server {
 	config := &Config{}
 	return &Server{
-		BaseServer: core.NewBaseServer(config),
+		BaseServer: core.NewBaseServer(config, options),
 	}
 }
 
@@ -3,11 +3,12 @@ package junior
 import (
 	"testing"
 
+	"github.com/anuramat/modagent/core"
 	"github.com/anuramat/modagent/testutils"
 )
 
 func TestNew(t *testing.T) {
-	server := New()
+	server := New(core.Options{})
 	if server == nil {
 		t.Fatal("Expected server to be created")
 	}
@@ -0,0 +1,236 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anuramat/modagent/core"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultMaxWait bounds the time a call spends queued when no limit sets it.
+const DefaultMaxWait = 30 * time.Second
+
+// Limit caps concurrency and throughput; zero fields are unlimited.
+type Limit struct {
+	MaxConcurrent     int
+	RequestsPerMinute int
+	MaxWait           time.Duration
+}
+
+func (l Limit) empty() bool {
+	return l.MaxConcurrent <= 0 && l.RequestsPerMinute <= 0
+}
+
+// Limiter applies a global limit and per-tool limits to tool calls. Calls
+// wait in FIFO order for a free slot until the max wait expires.
+type Limiter struct {
+	global *bucket
+	tools  map[string]*bucket
+	exempt map[string]bool
+}
+
+func New(global Limit, tools map[string]Limit) *Limiter {
+	l := &Limiter{tools: make(map[string]*bucket), exempt: make(map[string]bool)}
+	if !global.empty() {
+		l.global = newBucket("all tools", global)
+	}
+	for name, limit := range tools {
+		if !limit.empty() {
+			l.tools[name] = newBucket(name, limit)
+		}
+	}
+	return l
+}
+
+// Enabled reports whether any limit is configured.
+func (l *Limiter) Enabled() bool {
+	return l.global != nil || len(l.tools) > 0
+}
+
+// Exempt lets calls of the tools bypass Middleware. It's meant for tools
+// that only wait for work limited on its own, such as job_result, which
+// would otherwise hold a slot while waiting.
+func (l *Limiter) Exempt(tools ...string) {
+	for _, tool := range tools {
+		l.exempt[tool] = true
+	}
+}
+
+// Middleware queues tool calls according to the configured limits.
+func (l *Limiter) Middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if l.exempt[request.Params.Name] {
+			return next(ctx, request)
+		}
+		ctx = core.WithProgress(ctx, request)
+		release, err := l.Acquire(ctx, request.Params.Name)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer release()
+		return next(ctx, request)
+	}
+}
+
+// Acquire blocks until the tool may run and returns a function releasing the
+// slot.
+func (l *Limiter) Acquire(ctx context.Context, tool string) (func(), error) {
+	var buckets []*bucket
+	if b, ok := l.tools[tool]; ok {
+		buckets = append(buckets, b)
+	}
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+
+	maxWait := time.Duration(0)
+	for _, b := range buckets {
+		if b.limit.MaxWait > 0 && (maxWait == 0 || b.limit.MaxWait < maxWait) {
+			maxWait = b.limit.MaxWait
+		}
+	}
+	if maxWait == 0 {
+		maxWait = DefaultMaxWait
+	}
+	deadline := time.Now().Add(maxWait)
+
+	var releases []func()
+	releaseAll := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	progress := core.ProgressFromContext(ctx)
+	for _, b := range buckets {
+		release, err := b.acquire(ctx, deadline, progress)
+		if err != nil {
+			releaseAll()
+			if err == errTimeout {
+				return nil, fmt.Errorf("rate limited: no slot for %s became available within %s", b.name, maxWait)
+			}
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releaseAll, nil
+}
+
+var errTimeout = errors.New("timed out waiting for a slot")
+
+type waiter struct {
+	enqueued time.Time
+}
+
+type bucket struct {
+	name    string
+	limit   Limit
+	mu      sync.Mutex
+	active  int
+	recent  []time.Time
+	queue   []*waiter
+	changed chan struct{}
+}
+
+func newBucket(name string, limit Limit) *bucket {
+	return &bucket{name: name, limit: limit, changed: make(chan struct{})}
+}
+
+func (b *bucket) acquire(ctx context.Context, deadline time.Time, progress *core.Progress) (func(), error) {
+	w := &waiter{enqueued: time.Now()}
+	b.mu.Lock()
+	b.queue = append(b.queue, w)
+	b.mu.Unlock()
+	defer b.dequeue(w)
+
+	lastPosition := -1
+	for {
+		now := time.Now()
+		b.mu.Lock()
+		position := b.position(w)
+		retryIn, ok := b.tryTake(position, now)
+		changed := b.changed
+		b.mu.Unlock()
+		if ok {
+			return b.release, nil
+		}
+
+		remaining := deadline.Sub(now)
+		if remaining <= 0 {
+			return nil, errTimeout
+		}
+		if position != lastPosition {
+			progress.Report(fmt.Sprintf("queued for %s: position %d", b.name, position+1))
+			lastPosition = position
+		}
+
+		timer := time.NewTimer(min(retryIn, remaining))
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// tryTake takes a slot for the waiter at position; otherwise it returns how
+// long to wait before retrying, unless woken up earlier by a change.
+func (b *bucket) tryTake(position int, now time.Time) (time.Duration, bool) {
+	const idle = time.Minute
+	if position != 0 {
+		return idle, false
+	}
+	if b.limit.MaxConcurrent > 0 && b.active >= b.limit.MaxConcurrent {
+		return idle, false
+	}
+	if b.limit.RequestsPerMinute > 0 {
+		cutoff := now.Add(-time.Minute)
+		for len(b.recent) > 0 && !b.recent[0].After(cutoff) {
+			b.recent = b.recent[1:]
+		}
+		if len(b.recent) >= b.limit.RequestsPerMinute {
+			return b.recent[0].Sub(cutoff), false
+		}
+		b.recent = append(b.recent, now)
+	}
+	b.active++
+	return 0, true
+}
+
+func (b *bucket) release() {
+	b.mu.Lock()
+	b.active--
+	b.broadcast()
+	b.mu.Unlock()
+}
+
+func (b *bucket) dequeue(w *waiter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if i := b.position(w); i >= 0 {
+		b.queue = append(b.queue[:i], b.queue[i+1:]...)
+	}
+	b.broadcast()
+}
+
+func (b *bucket) position(w *waiter) int {
+	for i, q := range b.queue {
+		if q == w {
+			return i
+		}
+	}
+	return -1
+}
+
+// broadcast wakes up all waiters; must be called with mu held.
+func (b *bucket) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
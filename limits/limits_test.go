@@ -0,0 +1,111 @@
+package limits
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	limiter := New(Limit{}, map[string]Limit{
+		"junior-rwx": {MaxConcurrent: 1, MaxWait: 50 * time.Millisecond},
+	})
+
+	release, err := limiter.Acquire(context.Background(), "junior-rwx")
+	testutils.AssertNoError(t, err)
+
+	_, err = limiter.Acquire(context.Background(), "junior-rwx")
+	testutils.AssertError(t, err)
+	testutils.AssertContains(t, err.Error(), "rate limited")
+
+	// Other tools are not affected by the per-tool limit
+	other, err := limiter.Acquire(context.Background(), "junior-r")
+	testutils.AssertNoError(t, err)
+	other()
+
+	release()
+	release, err = limiter.Acquire(context.Background(), "junior-rwx")
+	testutils.AssertNoError(t, err)
+	release()
+}
+
+func TestQueuedCallRunsAfterRelease(t *testing.T) {
+	limiter := New(Limit{MaxConcurrent: 1, MaxWait: time.Second}, nil)
+
+	release, err := limiter.Acquire(context.Background(), "logworm")
+	testutils.AssertNoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var queuedErr error
+	go func() {
+		defer wg.Done()
+		r, err := limiter.Acquire(context.Background(), "junior-r")
+		queuedErr = err
+		if err == nil {
+			r()
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	release()
+	wg.Wait()
+	testutils.AssertNoError(t, queuedErr)
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	limiter := New(Limit{RequestsPerMinute: 2, MaxWait: 50 * time.Millisecond}, nil)
+	for i := 0; i < 2; i++ {
+		release, err := limiter.Acquire(context.Background(), "junior-r")
+		testutils.AssertNoError(t, err)
+		release()
+	}
+	_, err := limiter.Acquire(context.Background(), "junior-r")
+	testutils.AssertError(t, err)
+}
+
+func TestMiddlewareReturnsToolError(t *testing.T) {
+	limiter := New(Limit{MaxConcurrent: 1, MaxWait: 10 * time.Millisecond}, nil)
+	release, err := limiter.Acquire(context.Background(), "junior-r")
+	testutils.AssertNoError(t, err)
+	defer release()
+
+	called := false
+	handler := limiter.Middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		called = true
+		return mcp.NewToolResultText("ok"), nil
+	})
+	result, err := handler(context.Background(), testutils.CreateMCPRequest("junior-r", nil))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, true, result.IsError)
+	testutils.AssertEqual(t, false, called)
+	text := result.Content[0].(mcp.TextContent).Text
+	if !strings.HasPrefix(text, "rate limited") {
+		t.Fatalf("Expected rate limited error, got %q", text)
+	}
+}
+
+func TestExempt(t *testing.T) {
+	limiter := New(Limit{MaxConcurrent: 1, MaxWait: 10 * time.Millisecond}, nil)
+	limiter.Exempt("job_result")
+	release, err := limiter.Acquire(context.Background(), "junior-r")
+	testutils.AssertNoError(t, err)
+	defer release()
+
+	handler := limiter.Middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	result, err := handler(context.Background(), testutils.CreateMCPRequest("job_result", nil))
+	testutils.AssertNoError(t, err)
+	testutils.AssertEqual(t, false, result.IsError)
+}
+
+func TestDisabled(t *testing.T) {
+	testutils.AssertEqual(t, false, New(Limit{MaxWait: time.Second}, nil).Enabled())
+	testutils.AssertEqual(t, true, New(Limit{}, map[string]Limit{"logworm": {MaxConcurrent: 1}}).Enabled())
+}
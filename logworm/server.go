@@ -3,8 +3,10 @@ package logworm
 import (
 	"context"
 	"encoding/json"
-	"os/exec"
+	"fmt"
+	"strings"
 
+	"github.com/anuramat/modagent/audit"
 	"github.com/anuramat/modagent/core"
 	"github.com/mark3labs/mcp-go/mcp"
 )
@@ -16,15 +18,16 @@ type Server struct {
 
 type Config struct{}
 
-func New(passthroughThreshold int) *Server {
+func New(passthroughThreshold int, options core.Options) *Server {
 	config := &Config{}
 	return &Server{
-		BaseServer:           core.NewBaseServer(config),
+		BaseServer:           core.NewBaseServer(config, options),
 		passthroughThreshold: passthroughThreshold,
 	}
 }
 
 func (s *Server) HandleCall(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ctx = core.WithProgress(ctx, request)
 	args := request.GetArguments()
 
 	bashCmd, ok := args["bash_cmd"].(string)
@@ -32,15 +35,46 @@ func (s *Server) HandleCall(ctx context.Context, request mcp.CallToolRequest) (*
 		return mcp.NewToolResultError("bash_cmd is required and must be a string"), nil
 	}
 
+	coreArgs := map[string]any{
+		"prompt":   "Parse and analyze this command output",
+		"bash_cmd": bashCmd,
+		"role":     "logworm",
+	}
+	for _, key := range []string{"cwd", "env", "session", "bash_stdin"} {
+		if val, exists := args[key]; exists {
+			coreArgs[key] = val
+		}
+	}
+
+	params, err := core.ParseArgs(coreArgs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	cwd, err := s.ResolveCwd(ctx, params.Cwd)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	params.Cwd = cwd
+	stdin, err := s.ReadBashStdin(ctx, params)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
 	// Execute command and check output length for passthrough
-	cmd := exec.CommandContext(ctx, "bash", "-c", bashCmd)
+	progress := core.ProgressFromContext(ctx)
+	progress.Report("running bash_cmd: " + bashCmd)
+	cmd := s.ExecPolicy().BashCommand(ctx, bashCmd, cwd, params.Env)
+	cmd.Stdin = strings.NewReader(stdin)
 	output, err := cmd.Output()
+	audit.FromContext(ctx).SetExec(bashCmd, cmd.ProcessState.ExitCode())
 	if err != nil {
 		return mcp.NewToolResultError("Failed to execute command: " + err.Error()), nil
 	}
+	progress.Report(fmt.Sprintf("bash_cmd exited with status %d: %s", cmd.ProcessState.ExitCode(), bashCmd))
 
 	// If output is shorter than threshold, return it directly
 	if len(output) < s.passthroughThreshold {
+		progress.Report(fmt.Sprintf("returning %d bytes of output as is, below the passthrough threshold", len(output)))
 		response := map[string]interface{}{
 			"response":     string(output),
 			"conversation": "",
@@ -49,13 +83,9 @@ func (s *Server) HandleCall(ctx context.Context, request mcp.CallToolRequest) (*
 		return mcp.NewToolResultText(string(jsonResponse)), nil
 	}
 
-	// Otherwise, use the normal logworm processing
-	coreArgs := map[string]any{
-		"prompt":   "Parse and analyze this command output",
-		"bash_cmd": bashCmd,
-		"role":     "logworm",
-	}
-
+	// Otherwise, use the normal logworm processing; the output is analysed
+	// in a single pass, so there are no per-chunk phases to report
+	progress.Report(fmt.Sprintf("analysing %d bytes of output", len(output)))
 	coreRequest := mcp.CallToolRequest{
 		Params: mcp.CallToolParams{
 			Name:      "logworm",
@@ -1,13 +1,22 @@
 package logworm
 
 import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/core"
 	"github.com/anuramat/modagent/testutils"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
 )
 
 func TestNew(t *testing.T) {
-	server := New(2000)
+	server := New(2000, core.Options{})
 	if server == nil {
 		t.Fatal("Expected server to be created")
 	}
@@ -40,3 +49,55 @@ func TestConfigGetDefaultRole(t *testing.T) {
 		testutils.AssertEqual(t, tt.Expected, result)
 	})
 }
+
+type testSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *testSession) Initialize()       {}
+func (s *testSession) Initialized() bool { return true }
+func (s *testSession) SessionID() string { return "test" }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestHandleCallProgress(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-logworm-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	testutils.AssertNoError(t, os.WriteFile(filepath.Join(dir, "mods"), []byte("#!/bin/sh\ncat >/dev/null\necho analysed\n"), 0o755))
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+
+	tests := []testutils.TableTest{
+		{Name: "passthrough", Input: 100, Expected: "returning 3 bytes of output as is, below the passthrough threshold"},
+		{Name: "analysis", Input: 0, Expected: "analysing 3 bytes of output,running bash_cmd: echo hi,bash_cmd exited with status 0: echo hi,waiting for model,analysed\n"},
+	}
+	testutils.RunTableTests(t, tests, func(t *testing.T, tt testutils.TableTest) {
+		s := New(tt.Input.(int), core.Options{Artifacts: artifacts.NewStore(filepath.Join(dir, "artifacts"))})
+		mcpServer := server.NewMCPServer("test", "0")
+		mcpServer.AddTool(mcp.NewTool("logworm"), s.HandleCall)
+		session := &testSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+		ctx := mcpServer.WithContext(context.Background(), session)
+
+		message, err := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params": map[string]any{
+				"name":      "logworm",
+				"arguments": map[string]any{"bash_cmd": "echo hi", "cwd": dir},
+				"_meta":     map[string]any{"progressToken": "token"},
+			},
+		})
+		testutils.AssertNoError(t, err)
+		mcpServer.HandleMessage(ctx, message)
+		close(session.notifications)
+
+		var messages []string
+		for notification := range session.notifications {
+			messages = append(messages, notification.Params.AdditionalFields["message"].(string))
+		}
+		expected := "running bash_cmd: echo hi,bash_cmd exited with status 0: echo hi," + tt.Expected.(string)
+		testutils.AssertEqual(t, expected, strings.Join(messages, ","))
+	})
+}
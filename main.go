@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 
+	"github.com/anuramat/modagent/artifacts"
+	"github.com/anuramat/modagent/audit"
 	"github.com/anuramat/modagent/config"
+	"github.com/anuramat/modagent/conversation"
+	"github.com/anuramat/modagent/core"
+	"github.com/anuramat/modagent/jobs"
 	"github.com/anuramat/modagent/junior"
 	"github.com/anuramat/modagent/logworm"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -31,23 +37,152 @@ func main() {
 		os.Exit(1)
 	}
 
+	if flag.Arg(0) == "audit" {
+		if err := runAudit(cfg, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Audit query failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "artifacts" {
+		if err := runArtifacts(cfg, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Artifacts command failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "conversations" {
+		if err := runConversations(cfg, flag.Args()[1:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Conversations command failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	redactor, err := core.NewRedactor(cfg.GetRedactionPolicy())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to configure redaction: %v\n", err)
+		os.Exit(1)
+	}
+
+	sanitize := func(text string) string {
+		text, _ = redactor.Redact(text)
+		return text
+	}
+
+	var serverOptions []server.ServerOption
+	var auditLogger *audit.Logger
+	if settings, enabled := cfg.GetAuditSettings(); enabled {
+		auditLogger, err = audit.NewLogger(settings)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open audit log: %v\n", err)
+			os.Exit(1)
+		}
+		auditLogger.Sanitize = sanitize
+		serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(auditLogger.Middleware))
+	}
+	var acquire jobs.AcquireFunc
+	if limiter := cfg.GetLimiter(); limiter.Enabled() {
+		// job_result waits for jobs, which hold slots of their own
+		limiter.Exempt("job_result")
+		serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(limiter.Middleware))
+		acquire = limiter.Acquire
+	}
+
 	version := "unstable"
+	hooks := &server.Hooks{}
+	serverOptions = append(serverOptions, server.WithResourceCapabilities(true, true), server.WithHooks(hooks))
 	s := server.NewMCPServer(
 		"modagent",
 		version,
+		serverOptions...,
 	)
 
-	jr := junior.New()
-	lw := logworm.New(cfg.GetLogwormPassthroughThreshold())
+	conversations, err := conversation.NewStore(cfg.GetConversationsDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open conversation store: %v\n", err)
+		os.Exit(1)
+	}
 
-	juniorParams := []mcp.ToolOption{
-		mcp.WithString("prompt", mcp.Required(), mcp.Description("Your question or request for the junior AI")),
-		mcp.WithBoolean("json_output", mcp.Description("Default: false; response will be a structured JSON")),
-		mcp.WithString("conversation", mcp.Description("Continue previous conversation using its ID")),
-		mcp.WithArray("filepaths", mcp.Description("List of absolute paths to files that will be included as context")),
+	jobStore, err := jobs.NewStore(cfg.GetJobsDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open job store: %v\n", err)
+		os.Exit(1)
+	}
+	if err := jobStore.Prune(jobs.DefaultRetention); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to prune jobs: %v\n", err)
+	}
+
+	artifactStore := artifacts.NewStore(cfg.GetArtifactsDir())
+	artifactStore.Sanitize = sanitize
+	if policy, enabled := cfg.GetArtifactsPolicy(); enabled {
+		go artifactStore.RunCleanup(context.Background(), policy)
+	}
+
+	options := core.Options{
+		Exec:           cfg.GetExecPolicy(),
+		Roots:          core.NewRoots(cfg.GetRootsPolicy()),
+		Redactor:       redactor,
+		Conversations:  conversations,
+		IsolateClients: cfg.GetIsolateClients(),
+		Compaction:     cfg.GetCompactionPolicy(),
+		Files:          cfg.GetFilesPolicy(),
+		Budgets:        cfg.GetBudgets(),
+		ContextFormats: cfg.GetContextFormats(),
+		Attachments:    cfg.GetAttachmentsPolicy(),
+		Artifacts:      artifactStore,
+	}
+	s.AddNotificationHandler(mcp.MethodNotificationRootsListChanged, options.Roots.HandleListChanged)
+	hooks.AddOnUnregisterSession(options.Roots.HandleUnregisterSession)
+	artifactStore.Publish(s)
+
+	jr := junior.New(options)
+	lw := logworm.New(cfg.GetLogwormPassthroughThreshold(), options)
+	cv := conversation.New(conversations, jr.ResolveScope)
+	if err := cv.Publish(s, hooks); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to publish conversations: %v\n", err)
+		os.Exit(1)
+	}
+
+	jm := jobs.NewManager(jobStore, func(ctx context.Context, cwd string) (string, error) {
+		scope, err := jr.ResolveScope(ctx, cwd)
+		return scope.Project, err
+	}, acquire)
+	jm.Audit = auditLogger
+
+	cwdParam := mcp.WithString("cwd", mcp.Description("Absolute path to the working directory for bash_cmd and the junior itself"))
+	sessionParam := mcp.WithString("session", mcp.Description("Human-friendly session name (e.g. \"auth-refactor\"); continues the conversation of that name in the current project, or starts it"))
+	stdinParam := mcp.WithAny("bash_stdin", mcp.Description("Input for every bash command: text, or {\"path\": \"...\"} to read a file (relative paths are resolved against cwd)"))
+	envParam := mcp.WithObject("env", mcp.Description("Extra environment variables for bash_cmd, as a name to string value map"))
+
+	promptParam := mcp.WithString("prompt", mcp.Required(), mcp.Description("Your question or request for the junior AI"))
+	asyncParam := mcp.WithBoolean("async", mcp.Description("Default: false; start the call as a background job and return its ID immediately; collect the result with job_result"))
+
+	// contextParams gather the context shared by junior and junior-panel
+	contextParams := []mcp.ToolOption{
+		mcp.WithArray("filepaths", mcp.Description("Files, directories or glob patterns (e.g. \"src/**/*.go\") to include as context; relative entries are resolved against cwd, files ignored by git and binary files are skipped. Files may select lines (\"main.go:120-180\") or, for Go, a declaration (\"server.go#BaseServer.HandleCall\"). Images (PNG, JPEG, WebP) and PDFs are attached for multimodal backends; text-only backends get the text of PDFs")),
 		mcp.WithString("bash_cmd", mcp.Description("Bash command to execute; junior will receive the command itself, stdout, stderr, and its exit status")),
+		mcp.WithArray("bash_cmds", mcp.Description("More bash commands to execute after bash_cmd, each with its own exit status, output and temp directory (e.g. [\"git status\", \"go vet ./...\", \"go test ./...\"])")),
+		mcp.WithBoolean("bash_parallel", mcp.Description("Default: false; run the commands in parallel instead of one after another")),
+		mcp.WithBoolean("bash_stop_on_failure", mcp.Description("Default: false; stop at the first command that fails, skipping or stopping the rest")),
+		stdinParam,
+		mcp.WithString("git_diff", mcp.Description("Include a diff of the repository at cwd: \"worktree\" for unstaged changes, \"staged\" for the index, or a ref (e.g. \"main\") to diff the working tree against")),
+		mcp.WithNumber("git_log", mcp.Description("Include the last N commits with their patches")),
+		mcp.WithArray("git_blame", mcp.Description("Include git blame of these files, optionally limited to lines (\"main.go:120-180\") or a Go declaration (\"server.go#BaseServer.HandleCall\")")),
+		cwdParam,
+		envParam,
 	}
 
+	juniorParams := append([]mcp.ToolOption{
+		promptParam,
+		mcp.WithBoolean("json_output", mcp.Description("Default: false; response will be a structured JSON")),
+		mcp.WithObject("json_schema", mcp.Description("JSON Schema the response must match; implies json_output. Invalid replies are sent back for repair a couple of times; if they stay invalid, the raw reply is returned with validation_errors. $ref is not supported")),
+		mcp.WithString("conversation", mcp.Description("Continue previous conversation using its ID")),
+		sessionParam,
+	}, append(contextParams, asyncParam)...)
+
 	juniorRTool := mcp.NewTool("junior-r", append([]mcp.ToolOption{
 		mcp.WithDescription(cfg.GetToolDescription("junior-r", junior.Description+" (read-only mode)")),
 	}, juniorParams...)...)
@@ -56,21 +191,91 @@ func main() {
 		mcp.WithDescription(cfg.GetToolDescription("junior-rwx", junior.Description+" (full access mode)")),
 	}, juniorParams...)...)
 
+	juniorPanelTool := mcp.NewTool("junior-panel", append([]mcp.ToolOption{
+		mcp.WithDescription(cfg.GetToolDescription("junior-panel", junior.PanelDescription)),
+		promptParam,
+		mcp.WithArray("roles", mcp.Description("Mods roles to ask, e.g. [\"junior-r\", \"reviewer\"]; together with models, 2 to 8 members; junior-rwx is refused")),
+		mcp.WithArray("models", mcp.Description("Mods models to ask with the default read-only role, e.g. [\"gpt-4o\", \"sonnet\"]")),
+		mcp.WithString("aggregate",
+			mcp.Enum(core.AggregateNone, core.AggregateVote, core.AggregateSynthesize, core.AggregateJudge),
+			mcp.Description("Default: none; vote returns the most common answer, synthesize merges the answers into one, judge picks the best one"),
+		),
+		mcp.WithString("judge_role", mcp.Description("Mods role that synthesizes or judges the answers; defaults to the read-only role")),
+	}, append(contextParams, asyncParam)...)...)
+
 	logwormTool := mcp.NewTool("logworm",
 		mcp.WithDescription(cfg.GetToolDescription("logworm", logworm.Description)),
 		mcp.WithString("bash_cmd",
 			mcp.Required(),
 			mcp.Description("Bash command to execute and analyze its output"),
 		),
+		stdinParam,
+		cwdParam,
+		envParam,
+		sessionParam,
+	)
+
+	conversationsTool := mcp.NewTool("conversations",
+		mcp.WithDescription(cfg.GetToolDescription("conversations", conversation.Description)),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Enum("list", "show", "fork", "rename", "delete", "export", "import"),
+			mcp.Description("Operation to perform"),
+		),
+		mcp.WithString("id", mcp.Description("Conversation ID; required for every action except list and import")),
+		mcp.WithNumber("limit", mcp.Description("list: maximum number of conversations, most recent first (default: 20)")),
+		mcp.WithNumber("turn", mcp.Description("fork: number of turns to keep, starting from 1")),
+		mcp.WithString("title", mcp.Description("rename: new title; fork: optional title of the fork")),
+		mcp.WithString("format", mcp.Enum(conversation.FormatMarkdown, conversation.FormatJSON), mcp.Description("export: output format (default: markdown)")),
+		mcp.WithString("content", mcp.Description("import: a Markdown or JSON conversation export")),
+		mcp.WithString("cwd", mcp.Description("Absolute path inside the project whose conversations to manage; defaults to the client root")),
+	)
+
+	jobIDParam := mcp.WithString("id", mcp.Required(), mcp.Description("Job ID returned by the async call"))
+	jobCwdParam := mcp.WithString("cwd", mcp.Description("Absolute path inside the project that started the job; defaults to the client root"))
+
+	jobStatusTool := mcp.NewTool("job_status",
+		mcp.WithDescription(cfg.GetToolDescription("job_status", jobs.StatusDescription)),
+		jobIDParam,
+		jobCwdParam,
+	)
+
+	jobResultTool := mcp.NewTool("job_result",
+		mcp.WithDescription(cfg.GetToolDescription("job_result", jobs.ResultDescription)),
+		jobIDParam,
+		mcp.WithNumber("wait", mcp.Description("Seconds to wait for a running job to finish (default: 0, at most 600)")),
+		jobCwdParam,
+	)
+
+	jobCancelTool := mcp.NewTool("job_cancel",
+		mcp.WithDescription(cfg.GetToolDescription("job_cancel", jobs.CancelDescription)),
+		jobIDParam,
+		jobCwdParam,
+	)
+
+	jobListTool := mcp.NewTool("job_list",
+		mcp.WithDescription(cfg.GetToolDescription("job_list", jobs.ListDescription)),
+		mcp.WithString("status",
+			mcp.Enum(jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusFailed, jobs.StatusCancelled, jobs.StatusInterrupted),
+			mcp.Description("Only list jobs with this status"),
+		),
+		mcp.WithNumber("limit", mcp.Description("Maximum number of jobs, most recent first (default: 20)")),
+		jobCwdParam,
 	)
 
 	if !*logwormOnly {
-		s.AddTool(juniorRTool, jr.HandleCallReadonly)
-		s.AddTool(juniorRWXTool, jr.HandleCall)
+		s.AddTool(juniorRTool, jm.Async(jr.HandleCallReadonly))
+		s.AddTool(juniorRWXTool, jm.Async(jr.HandleCall))
+		s.AddTool(juniorPanelTool, jm.Async(jr.HandlePanel))
+		s.AddTool(jobStatusTool, jm.HandleStatus)
+		s.AddTool(jobResultTool, jm.HandleResult)
+		s.AddTool(jobCancelTool, jm.HandleCancel)
+		s.AddTool(jobListTool, jm.HandleList)
 	}
 	s.AddTool(logwormTool, lw.HandleCall)
+	s.AddTool(conversationsTool, cv.HandleCall)
 
-	if err := server.ServeStdio(s); err != nil {
+	if err := serveStdio(s, cv); err != nil {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 		os.Exit(1)
 	}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/anuramat/modagent/config"
+	"github.com/anuramat/modagent/conversation"
 	"github.com/anuramat/modagent/testutils"
 )
 
@@ -17,5 +20,32 @@ func TestGenerateConfigFunction(t *testing.T) {
 	// Load and validate generated config
 	cfg, err := config.LoadConfig()
 	testutils.AssertNoError(t, err)
-	testutils.AssertEqual(t, 3, len(cfg.Tools))
+	testutils.AssertEqual(t, 9, len(cfg.Tools))
+}
+
+func TestInterceptSubscriptions(t *testing.T) {
+	dir, cleanup, err := testutils.CreateTempDir("modagent-test-stdio-*")
+	testutils.AssertNoError(t, err)
+	defer cleanup()
+	store, err := conversation.NewStore(dir)
+	testutils.AssertNoError(t, err)
+	_, err = store.Append(conversation.Conversation{ID: "conv", Tool: "junior-r"}, conversation.Turn{Prompt: "question"})
+	testutils.AssertNoError(t, err)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"resources/subscribe","params":{"uri":"modagent://conversation/conv"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"resources/subscribe","params":{"uri":"modagent://conversation/missing"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/unsubscribe","params":{"uri":"modagent://conversation/conv"}}`,
+	}, "\n") + "\n"
+	var next, out bytes.Buffer
+	err = interceptSubscriptions(strings.NewReader(input), &next, &out, conversation.New(store, nil))
+	testutils.AssertNoError(t, err)
+
+	testutils.AssertEqual(t, `{"jsonrpc":"2.0","id":3,"method":"tools/list"}`+"\n", next.String())
+	responses := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	testutils.AssertEqual(t, 3, len(responses))
+	testutils.AssertContains(t, responses[0], `"id":1,"result":{}`)
+	testutils.AssertContains(t, responses[1], `"id":2,"error":{"code":-32602`)
+	testutils.AssertContains(t, responses[2], `"id":4,"result":{}`)
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/anuramat/modagent/conversation"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// stdioSessionID is the ID of the single session of mcp-go's stdio
+// transport.
+const stdioSessionID = "stdio"
+
+// serveStdio is server.ServeStdio, except that resource subscriptions,
+// which mcp-go doesn't dispatch, are answered by the conversations server.
+func serveStdio(s *server.MCPServer, cv *conversation.Server) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	out := &lineWriter{w: os.Stdout}
+	in, pipe := io.Pipe()
+	go func() {
+		pipe.CloseWithError(interceptSubscriptions(os.Stdin, pipe, out, cv))
+	}()
+	return server.NewStdioServer(s).Listen(ctx, in, out)
+}
+
+// lineWriter serialises writes, so that the responses written here don't
+// interleave with the server's, which write a whole line at once.
+type lineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// interceptSubscriptions copies messages from in to next, answering
+// subscription requests itself.
+func interceptSubscriptions(in io.Reader, next io.Writer, out io.Writer, cv *conversation.Server) error {
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if response := handleSubscription(line, cv); response != nil {
+				data, _ := json.Marshal(response)
+				if _, err := out.Write(append(data, '\n')); err != nil {
+					return err
+				}
+			} else if _, err := next.Write(line); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleSubscription answers a subscription request, and returns nil for
+// any other message.
+func handleSubscription(line []byte, cv *conversation.Server) any {
+	var request struct {
+		ID     mcp.RequestId       `json:"id"`
+		Method string              `json:"method"`
+		Params mcp.SubscribeParams `json:"params"`
+	}
+	if json.Unmarshal(line, &request) != nil || request.ID.IsNil() {
+		return nil
+	}
+	switch request.Method {
+	case conversation.MethodResourcesSubscribe:
+		if err := cv.Subscribe(stdioSessionID, request.Params.URI); err != nil {
+			return mcp.NewJSONRPCError(request.ID, mcp.INVALID_PARAMS, err.Error(), nil)
+		}
+	case conversation.MethodResourcesUnsubscribe:
+		cv.Unsubscribe(stdioSessionID, request.Params.URI)
+	default:
+		return nil
+	}
+	return mcp.NewJSONRPCResultResponse(request.ID, mcp.EmptyResult{})
+}